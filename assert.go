@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const assertionFailedPrefix = "assertion failed: "
+
+type headerAssertion struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+type jsonPathAssertion struct {
+	path     string
+	value    string
+	hasValue bool
+}
+
+// Assertions are the checks a response must pass to be counted as a success.
+type Assertions struct {
+	statuses   []string
+	contains   [][]byte
+	regexps    []*regexp.Regexp
+	headers    []headerAssertion
+	jsonPaths  []jsonPathAssertion
+	statusDesc string
+}
+
+func NewAssertions(statuses, contains, regexps, headers, jsonPaths []string) (*Assertions, error) {
+	if len(statuses)+len(contains)+len(regexps)+len(headers)+len(jsonPaths) == 0 {
+		return nil, nil
+	}
+	a := &Assertions{}
+	for _, s := range statuses {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len(s) != 3 {
+			return nil, fmt.Errorf("invalid expected status: %q", s)
+		}
+		if strings.HasSuffix(s, "xx") {
+			if s[0] < '1' || s[0] > '5' {
+				return nil, fmt.Errorf("invalid expected status: %q", s)
+			}
+		} else if _, err := strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("invalid expected status: %q", s)
+		}
+		a.statuses = append(a.statuses, s)
+	}
+	a.statusDesc = strings.Join(a.statuses, ",")
+	for _, s := range contains {
+		a.contains = append(a.contains, []byte(s))
+	}
+	for _, s := range regexps {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected body regex: %v", err)
+		}
+		a.regexps = append(a.regexps, re)
+	}
+	for _, h := range headers {
+		n := strings.SplitN(h, ":", 2)
+		ha := headerAssertion{key: strings.TrimSpace(n[0])}
+		if ha.key == "" {
+			return nil, fmt.Errorf("invalid expected header: %s", h)
+		}
+		if len(n) == 2 {
+			ha.value = strings.TrimSpace(n[1])
+			ha.hasValue = true
+		}
+		a.headers = append(a.headers, ha)
+	}
+	for _, p := range jsonPaths {
+		n := strings.SplitN(p, "=", 2)
+		ja := jsonPathAssertion{path: strings.TrimSpace(n[0])}
+		if ja.path == "" {
+			return nil, fmt.Errorf("invalid expected json path: %s", p)
+		}
+		if len(n) == 2 {
+			ja.value = n[1]
+			ja.hasValue = true
+		}
+		a.jsonPaths = append(a.jsonPaths, ja)
+	}
+	return a, nil
+}
+
+func (a *Assertions) checkStatus(code int) bool {
+	if len(a.statuses) == 0 {
+		return true
+	}
+	s := strconv.Itoa(code)
+	for _, expected := range a.statuses {
+		if expected == s || (strings.HasSuffix(expected, "xx") && expected[0] == s[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error describing the first failed assertion. The message
+// doesn't contain the response body so the error map stays small.
+func (a *Assertions) Check(resp *fasthttp.Response) error {
+	code := resp.StatusCode()
+	if !a.checkStatus(code) {
+		return fmt.Errorf(assertionFailedPrefix+"status %d, want %s", code, a.statusDesc)
+	}
+	body := resp.Body()
+	for _, c := range a.contains {
+		if !bytes.Contains(body, c) {
+			return fmt.Errorf(assertionFailedPrefix+"body does not contain %q", c)
+		}
+	}
+	for _, re := range a.regexps {
+		if !re.Match(body) {
+			return fmt.Errorf(assertionFailedPrefix+"body does not match /%s/", re)
+		}
+	}
+	for _, h := range a.headers {
+		v := resp.Header.Peek(h.key)
+		if v == nil {
+			return fmt.Errorf(assertionFailedPrefix+"header %s is missing", h.key)
+		}
+		if h.hasValue && string(v) != h.value {
+			return fmt.Errorf(assertionFailedPrefix+"header %s, want %q", h.key, h.value)
+		}
+	}
+	if len(a.jsonPaths) > 0 {
+		doc, err := decodeJSON(body)
+		if err != nil {
+			return errors.New(assertionFailedPrefix + "body is not valid JSON")
+		}
+		for _, ja := range a.jsonPaths {
+			v, ok := lookupJSONPath(doc, ja.path)
+			if !ok {
+				return fmt.Errorf(assertionFailedPrefix+"json path %s is missing", ja.path)
+			}
+			if ja.hasValue && jsonValueString(v) != ja.value {
+				return fmt.Errorf(assertionFailedPrefix+"json path %s, want %q", ja.path, ja.value)
+			}
+		}
+	}
+	return nil
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// lookupJSONPath walks a decoded JSON document along a simple path such as
+// "data.items[0].id", "data.items.0.id" or "$.data.id".
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	v := doc
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonValueString formats a JSON value the way it's written on the command
+// line: strings without quotes, everything else as JSON.
+func jsonValueString(v interface{}) string {
+	switch vv := v.(type) {
+	case string:
+		return vv
+	case json.Number:
+		return vv.String()
+	default:
+		b, _ := json.Marshal(vv)
+		return string(b)
+	}
+}
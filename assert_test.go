@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func testResponse(code int, body string, headers ...string) *fasthttp.Response {
+	resp := &fasthttp.Response{}
+	resp.SetStatusCode(code)
+	resp.SetBodyString(body)
+	for i := 0; i+1 < len(headers); i += 2 {
+		resp.Header.Set(headers[i], headers[i+1])
+	}
+	return resp
+}
+
+func TestNewAssertionsWithoutChecks(t *testing.T) {
+	a, err := NewAssertions(nil, nil, nil, nil, nil)
+	if err != nil || a != nil {
+		t.Fatalf("NewAssertions() = %v, %v, want nil, nil", a, err)
+	}
+}
+
+func TestNewAssertionsRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name                                        string
+		statuses, contains, regexps, headers, paths []string
+	}{
+		{name: "status text", statuses: []string{"ok"}},
+		{name: "status class", statuses: []string{"9xx"}},
+		{name: "regex", regexps: []string{"("}},
+		{name: "header", headers: []string{":value"}},
+		{name: "json path", paths: []string{"=1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAssertions(tt.statuses, tt.contains, tt.regexps, tt.headers, tt.paths); err == nil {
+				t.Fatal("NewAssertions succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestAssertionsCheck(t *testing.T) {
+	body := `{"data": {"id": 42, "ok": true, "items": [{"name": "foo"}, {"name": "bar"}]}}`
+	tests := []struct {
+		name                                        string
+		statuses, contains, regexps, headers, paths []string
+		resp                                        *fasthttp.Response
+		wantErr                                     string
+	}{
+		{name: "exact status", statuses: []string{"201", "200"}, resp: testResponse(200, "")},
+		{name: "status class", statuses: []string{"2xx"}, resp: testResponse(204, "")},
+		{name: "wrong status", statuses: []string{"2xx"}, resp: testResponse(503, ""), wantErr: "assertion failed: status 503, want 2xx"},
+		{name: "contains", contains: []string{`"id": 42`}, resp: testResponse(200, body)},
+		{name: "not contains", contains: []string{"welcome"}, resp: testResponse(200, "login"), wantErr: `assertion failed: body does not contain "welcome"`},
+		{name: "regex", regexps: []string{`"id": \d+`}, resp: testResponse(200, body)},
+		{name: "regex mismatch", regexps: []string{`^ok$`}, resp: testResponse(200, "nope"), wantErr: "assertion failed: body does not match /^ok$/"},
+		{name: "header present", headers: []string{"X-Trace"}, resp: testResponse(200, "", "X-Trace", "1")},
+		{name: "header value", headers: []string{"Content-Type: application/json"}, resp: testResponse(200, "", "Content-Type", "application/json")},
+		{name: "header missing", headers: []string{"X-Trace"}, resp: testResponse(200, ""), wantErr: "assertion failed: header X-Trace is missing"},
+		{name: "header mismatch", headers: []string{"X-Mode:fast"}, resp: testResponse(200, "", "X-Mode", "slow"), wantErr: `assertion failed: header X-Mode, want "fast"`},
+		{name: "json path exists", paths: []string{"data.items[1].name", "$.data.ok"}, resp: testResponse(200, body)},
+		{name: "json path values", paths: []string{"data.id=42", "data.ok=true", "data.items.0.name=foo"}, resp: testResponse(200, body)},
+		{name: "json path mismatch", paths: []string{"data.id=7"}, resp: testResponse(200, body), wantErr: `assertion failed: json path data.id, want "7"`},
+		{name: "json path missing", paths: []string{"data.items[5]"}, resp: testResponse(200, body), wantErr: "assertion failed: json path data.items[5] is missing"},
+		{name: "invalid json", paths: []string{"data"}, resp: testResponse(200, "<html>"), wantErr: "assertion failed: body is not valid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAssertions(tt.statuses, tt.contains, tt.regexps, tt.headers, tt.paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = a.Check(tt.resp)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Check() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("Check() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequesterRecordsAssertionFailures(t *testing.T) {
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("please login")
+	})
+
+	assertions, err := NewAssertions(nil, []string{"welcome"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errOut bytes.Buffer
+	requester, err := NewRequester(1, 2, 0, nil, &errOut, &ClientOpt{
+		url:         "http://" + addr + "/",
+		method:      fasthttp.MethodGet,
+		assertions:  assertions,
+		maxConns:    1,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range collectRecords(t, requester) {
+		if record.code != fasthttp.StatusOK || record.error != `assertion failed: body does not contain "welcome"` {
+			t.Fatalf("record = code %d error %q, want 200 with assertion failure", record.code, record.error)
+		}
+	}
+	if out := errOut.String(); !strings.Contains(out, "assertion failed") || !strings.Contains(out, "please login") {
+		t.Fatalf("error output = %q, want the failed assertion and response body", out)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -30,10 +31,13 @@ var assetsFS embed.FS
 var (
 	assetsPath      = "/echarts/statics/"
 	apiPath         = "/data/"
+	metricsPath     = "/metrics"
 	latencyView     = "latency"
 	rpsView         = "rps"
 	codeView        = "code"
 	concurrencyView = "concurrency"
+	labelView       = "label"
+	timingView      = "timing"
 	timeFormat      = "15:04:05"
 	refreshInterval = time.Second
 
@@ -42,6 +46,8 @@ var (
 		latencyView:     ViewTpl,
 		codeView:        CodeViewTpl,
 		concurrencyView: ViewTpl,
+		labelView:       LabelViewTpl,
+		timingView:      LabelViewTpl,
 	}
 )
 
@@ -134,6 +140,42 @@ function {{ .ViewID }}_sync() {
 			goecharts_{{ .ViewID }}.setOption(opt);
         }
     });
+}`
+	LabelViewTpl = `
+$(function () { setInterval({{ .ViewID }}_sync, {{ .Interval }}); });
+function {{ .ViewID }}_sync() {
+    $.ajax({
+        type: "GET",
+        url: "{{ .APIPath }}{{ .Route }}",
+        dataType: "json",
+        success: function (result) {
+            let opt = goecharts_{{ .ViewID }}.getOption();
+            let x = opt.xAxis[0].data;
+            x.push(result.time);
+            opt.xAxis[0].data = x;
+
+            let labels = result.values[0] || {};
+            let seen = {};
+            for (let i = 0; i < opt.series.length; i++) {
+                let series = opt.series[i];
+                seen[series.name] = true;
+                series.data.push({ value: series.name in labels ? labels[series.name] : null });
+            }
+            for (let label in labels) {
+                if (label in seen) {
+                    continue;
+                }
+                let data = [];
+                for (let i = 0; i < x.length - 1; i++) {
+                    data.push(null);
+                }
+                data.push({ value: labels[label] });
+                opt.series.push({ name: label, type: 'line', smooth: true, data: data });
+            }
+
+            goecharts_{{ .ViewID }}.setOption(opt);
+        }
+    });
 }`
 )
 
@@ -226,15 +268,36 @@ func (c *Charts) newConcurrencyView() components.Charter {
 	return graph
 }
 
+func (c *Charts) newLabelView() components.Charter {
+	graph := c.newBasicView(labelView)
+	graph.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{Title: "Latency by Label"}),
+		charts.WithYAxisOpts(opts.YAxis{Scale: opts.Bool(true), AxisLabel: &opts.AxisLabel{Formatter: "{value} ms"}}),
+		charts.WithLegendOpts(opts.Legend{Show: opts.Bool(true)}),
+	)
+	return graph
+}
+
+func (c *Charts) newTimingView() components.Charter {
+	graph := c.newBasicView(timingView)
+	graph.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{Title: "Timings"}),
+		charts.WithYAxisOpts(opts.YAxis{Scale: opts.Bool(true), AxisLabel: &opts.AxisLabel{Formatter: "{value} ms"}}),
+		charts.WithLegendOpts(opts.Legend{Show: opts.Bool(true)}),
+	)
+	return graph
+}
+
 type Metrics struct {
 	Values []interface{} `json:"values"`
 	Time   string        `json:"time"`
 }
 
 type Charts struct {
-	page     *components.Page
-	ln       net.Listener
-	dataFunc func() *ChartsReport
+	page        *components.Page
+	ln          net.Listener
+	dataFunc    func() *ChartsReport
+	metricsFunc func(w *bytes.Buffer)
 }
 
 func NewCharts(ln net.Listener, dataFunc func() *ChartsReport, desc string) (*Charts, error) {
@@ -250,6 +313,36 @@ func NewCharts(ln net.Listener, dataFunc func() *ChartsReport, desc string) (*Ch
 	return c, nil
 }
 
+// AddLabelView adds the mean latency chart of each request label to the page.
+func (c *Charts) AddLabelView() {
+	c.page.AddCharts(c.newLabelView())
+}
+
+// AddTimingView adds the mean duration chart of each phase of --timings.
+func (c *Charts) AddTimingView() {
+	c.page.AddCharts(c.newTimingView())
+}
+
+// AddMetrics serves the Prometheus metrics written by metricsFunc at
+// /metrics.
+func (c *Charts) AddMetrics(metricsFunc func(w *bytes.Buffer)) {
+	c.metricsFunc = metricsFunc
+}
+
+// chartCodes keys the status codes by the series name shown in the code
+// chart, gRPC codes are named as they're not numbers users know.
+func chartCodes(codes map[int]int64) map[string]int64 {
+	res := make(map[string]int64, len(codes))
+	for k, v := range codes {
+		if k >= grpcCodeOffset {
+			res[grpcCodeName(k)] = v
+		} else {
+			res[strconv.Itoa(k)] = v
+		}
+	}
+	return res
+}
+
 func (c *Charts) Handler(ctx *fasthttp.RequestCtx) {
 	path := string(ctx.Path())
 	if strings.HasPrefix(path, apiPath) {
@@ -273,7 +366,7 @@ func (c *Charts) Handler(ctx *fasthttp.RequestCtx) {
 			}
 		case codeView:
 			if reportData != nil {
-				values = append(values, reportData.CodeMap)
+				values = append(values, chartCodes(reportData.CodeMap))
 			} else {
 				values = append(values, nil)
 			}
@@ -283,12 +376,37 @@ func (c *Charts) Handler(ctx *fasthttp.RequestCtx) {
 			} else {
 				values = append(values, nil)
 			}
+		case labelView:
+			if reportData != nil {
+				labels := make(map[string]float64, len(reportData.LabelLatency))
+				for label, latency := range reportData.LabelLatency {
+					labels[label] = latency.Mean() / 1e6
+				}
+				values = append(values, labels)
+			} else {
+				values = append(values, nil)
+			}
+		case timingView:
+			if reportData != nil {
+				phases := make(map[string]float64, len(reportData.PhaseLatency))
+				for phase, latency := range reportData.PhaseLatency {
+					phases[phase] = latency.Mean() / 1e6
+				}
+				values = append(values, phases)
+			} else {
+				values = append(values, nil)
+			}
 		}
 		metrics := &Metrics{
 			Time:   time.Now().Format(timeFormat),
 			Values: values,
 		}
 		_ = json.NewEncoder(ctx).Encode(metrics)
+	} else if path == metricsPath && c.metricsFunc != nil {
+		var buf bytes.Buffer
+		c.metricsFunc(&buf)
+		ctx.SetContentType("text/plain; version=0.0.4; charset=utf-8")
+		ctx.SetBody(buf.Bytes())
 	} else if path == "/" {
 		ctx.SetContentType("text/html")
 		_ = c.page.Render(ctx)
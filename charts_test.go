@@ -61,10 +61,11 @@ func TestChartsHandlerDataEndpoints(t *testing.T) {
 		latency.Update(float64(10 * time.Millisecond))
 		latency.Update(float64(30 * time.Millisecond))
 		return &ChartsReport{
-			RPS:         99.5,
-			Latency:     latency,
-			CodeMap:     map[int]int64{200: 2, 503: 1},
-			Concurrency: 8,
+			RPS:          99.5,
+			Latency:      latency,
+			CodeMap:      map[int]int64{200: 2, 503: 1},
+			Concurrency:  8,
+			LabelLatency: map[string]Stats{"GET /a": latency},
 		}
 	})
 
@@ -127,6 +128,20 @@ func TestChartsHandlerDataEndpoints(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:      "label",
+			path:      apiPath + labelView,
+			wantItems: 1,
+			assert: func(t *testing.T, got chartHTTPResponse) {
+				var labels map[string]float64
+				if err := json.Unmarshal(got.Values[0], &labels); err != nil {
+					t.Fatalf("label map is invalid: %v", err)
+				}
+				if labels["GET /a"] != 20 {
+					t.Fatalf("labels = %#v, want GET /a=20", labels)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -151,6 +166,7 @@ func TestChartsHandlerDataEndpointsWithNoData(t *testing.T) {
 		{apiPath + rpsView, 1},
 		{apiPath + codeView, 1},
 		{apiPath + concurrencyView, 1},
+		{apiPath + labelView, 1},
 	} {
 		t.Run(tt.path, func(t *testing.T) {
 			got := decodeChartResponse(t, handleChartRequest(charts, tt.path))
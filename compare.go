@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type comparisonKind int
+
+const (
+	comparisonRPS comparisonKind = iota
+	comparisonLatency
+	comparisonRate
+)
+
+// Comparison is one metric of a baseline and a current report, the rates
+// are ratios of the request count.
+type Comparison struct {
+	Metric    string
+	Baseline  float64
+	Current   float64
+	Regressed bool
+	kind      comparisonKind
+}
+
+// Delta is the relative change of RPS and latencies, and the change in
+// percentage points of rates.
+func (c *Comparison) Delta() float64 {
+	if c.kind == comparisonRate {
+		return (c.Current - c.Baseline) * 100
+	}
+	if c.Baseline == 0 {
+		if c.Current == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (c.Current - c.Baseline) / c.Baseline * 100
+}
+
+func (c *Comparison) valueString(v float64, useSeconds bool) string {
+	switch c.kind {
+	case comparisonLatency:
+		return durationToString(time.Duration(v), useSeconds)
+	case comparisonRate:
+		return formatFloat64(float64(int64(v*1e6+0.5))/1e4) + "%"
+	}
+	return fmt.Sprintf("%.3f", v)
+}
+
+func (c *Comparison) DeltaString() string {
+	d := c.Delta()
+	if math.IsInf(d, 1) {
+		return "+inf%"
+	}
+	s := strconv.FormatFloat(d, 'f', 2, 64)
+	if d >= 0 {
+		s = "+" + s
+	}
+	if c.kind == comparisonRate {
+		return s + "pp"
+	}
+	return s + "%"
+}
+
+// LoadExportedReport reads a JSON report written by --report-out.
+func LoadExportedReport(path string) (*ExportedReport, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e ExportedReport
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("%s: not a json --report-out file: %v", path, err)
+	}
+	if e.Report == nil {
+		return nil, fmt.Errorf("%s: not a json --report-out file: no report", path)
+	}
+	return &e, nil
+}
+
+// isErrorStatus tells the status codes whose growth is a regression, the
+// HTTP 4xx and 5xx and every gRPC code but OK.
+func isErrorStatus(status string) bool {
+	if code, err := strconv.Atoi(status); err == nil {
+		return code >= 400
+	}
+	return status != grpcCodeName(grpcCodeOffset)
+}
+
+func errorRate(s *SnapshotReport) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	var errors int64
+	for _, v := range s.Errors {
+		errors += v
+	}
+	return float64(errors) / float64(s.Count)
+}
+
+func statusRate(s *SnapshotReport, status string) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.StatusCodes[status]) / float64(s.Count)
+}
+
+// Compare compares current to baseline. RPS and latencies regress when
+// they get worse by more than tolerance percent, the error rate and the
+// share of the error statuses when they grow by more than rateTolerance
+// percentage points.
+func Compare(baseline, current *SnapshotReport, tolerance, rateTolerance float64) []*Comparison {
+	cmps := []*Comparison{{Metric: "RPS", Baseline: baseline.RPS, Current: current.RPS, kind: comparisonRPS}}
+	for _, bp := range baseline.Percentiles {
+		for _, cp := range current.Percentiles {
+			if bp.Percentile == cp.Percentile {
+				cmps = append(cmps, &Comparison{
+					Metric:   percentileName(bp.Percentile),
+					Baseline: float64(bp.Latency),
+					Current:  float64(cp.Latency),
+					kind:     comparisonLatency,
+				})
+				break
+			}
+		}
+	}
+	cmps = append(cmps, &Comparison{Metric: "Error rate", Baseline: errorRate(baseline), Current: errorRate(current), kind: comparisonRate})
+
+	statuses := map[string]int64{}
+	for k := range baseline.StatusCodes {
+		statuses[k] = 0
+	}
+	for k := range current.StatusCodes {
+		statuses[k] = 0
+	}
+	for _, status := range sortedKeys(statuses) {
+		cmps = append(cmps, &Comparison{Metric: status, Baseline: statusRate(baseline, status), Current: statusRate(current, status), kind: comparisonRate})
+	}
+
+	for _, c := range cmps {
+		d := c.Delta()
+		switch {
+		case c.kind == comparisonRPS:
+			c.Regressed = d < -tolerance
+		case c.kind == comparisonLatency:
+			c.Regressed = d > tolerance
+		case c.Metric == "Error rate" || isErrorStatus(c.Metric):
+			c.Regressed = d > rateTolerance
+		}
+	}
+	return cmps
+}
+
+func Regressions(cmps []*Comparison) (n int) {
+	for _, c := range cmps {
+		if c.Regressed {
+			n++
+		}
+	}
+	return
+}
+
+func buildComparison(cmps []*Comparison, useSeconds bool) [][]string {
+	bulk := [][]string{{"", "Baseline", "Current", "Delta"}}
+	for i, c := range cmps {
+		metric := c.Metric
+		if c.kind == comparisonRate && metric != "Error rate" {
+			if i == 0 || cmps[i-1].Metric == "Error rate" {
+				bulk = append(bulk, []string{"Status codes:"})
+			}
+			metric = "  " + metric
+		}
+		row := []string{metric, c.valueString(c.Baseline, useSeconds), c.valueString(c.Current, useSeconds), c.DeltaString()}
+		if c.Regressed {
+			row[3] = colorize(row[3], FgMagentaColor)
+			row = append(row, colorize("regressed", FgMagentaColor))
+		}
+		bulk = append(bulk, row)
+	}
+	alignBulk(bulk, AlignLeft, AlignRight, AlignRight, AlignRight, AlignLeft)
+	return bulk
+}
+
+func buildJSONComparison(writer *bytes.Buffer, cmps []*Comparison, useSeconds bool, indent int) {
+	tab0 := strings.Repeat("  ", indent)
+	writer.WriteString(tab0 + "\"Comparison\": [\n")
+	tab1 := strings.Repeat("  ", indent+1)
+	for i, c := range cmps {
+		mb, _ := json.Marshal(c.Metric)
+		bb, _ := json.Marshal(c.valueString(c.Baseline, useSeconds))
+		cb, _ := json.Marshal(c.valueString(c.Current, useSeconds))
+		writer.WriteString(fmt.Sprintf(`%s{ "Metric": %s, "Baseline": %s, "Current": %s, "Delta": %q, "Regressed": %t }`, tab1, mb, bb, cb, c.DeltaString(), c.Regressed))
+		if i != len(cmps)-1 {
+			writer.WriteString(",")
+		}
+		writer.WriteString("\n")
+	}
+	writer.WriteString(tab0 + "]")
+}
+
+func writeJSONComparison(writer *bytes.Buffer, cmps []*Comparison, useSeconds bool) {
+	writer.WriteString("{\n")
+	buildJSONComparison(writer, cmps, useSeconds, 1)
+	writer.WriteString("\n}\n")
+}
+
+// FormatComparison writes the side-by-side table of cmps, or its JSON.
+func FormatComparison(writer *bytes.Buffer, cmps []*Comparison, useSeconds, asJSON bool) {
+	if asJSON {
+		writeJSONComparison(writer, cmps, useSeconds)
+		return
+	}
+	writer.WriteString("Comparison:\n")
+	writeBulk(writer, buildComparison(cmps, useSeconds))
+}
+
+// parsePercent parses a tolerance such as 10 or 10%.
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid tolerance %q, examples: 10%%, 0.5", s)
+	}
+	return v, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCompareSnapshot(rps float64, p99 time.Duration, codes map[string]int64, errors int64) *SnapshotReport {
+	s := &SnapshotReport{RPS: rps, StatusCodes: codes, Errors: map[string]int64{}}
+	for _, n := range codes {
+		s.Count += n
+	}
+	if errors > 0 {
+		s.Count += errors
+		s.Errors["timeout"] = errors
+	}
+	s.Percentiles = []*struct {
+		Percentile float64
+		Latency    time.Duration
+	}{{0.5, 10 * time.Millisecond}, {0.99, p99}}
+	return s
+}
+
+func findComparison(t *testing.T, cmps []*Comparison, metric string) *Comparison {
+	t.Helper()
+	for _, c := range cmps {
+		if c.Metric == metric {
+			return c
+		}
+	}
+	t.Fatalf("no comparison of %s in %+v", metric, cmps)
+	return nil
+}
+
+func TestCompare(t *testing.T) {
+	baseline := newCompareSnapshot(1000, 100*time.Millisecond, map[string]int64{"200": 990, "404": 10}, 0)
+	current := newCompareSnapshot(850, 105*time.Millisecond, map[string]int64{"200": 940, "429": 50}, 10)
+	cmps := Compare(baseline, current, 10, 1)
+
+	for metric, want := range map[string]bool{"RPS": true, "p50": false, "p99": false, "Error rate": false, "200": false, "404": false, "429": true} {
+		if c := findComparison(t, cmps, metric); c.Regressed != want {
+			t.Fatalf("%s regressed = %t, want %t, delta %s", metric, c.Regressed, want, c.DeltaString())
+		}
+	}
+	if d := findComparison(t, cmps, "RPS").DeltaString(); d != "-15.00%" {
+		t.Fatalf("RPS delta = %s, want -15.00%%", d)
+	}
+	if d := findComparison(t, cmps, "429").DeltaString(); d != "+5.00pp" {
+		t.Fatalf("429 delta = %s, want +5.00pp", d)
+	}
+	if n := Regressions(cmps); n != 2 {
+		t.Fatalf("regressions = %d, want 2", n)
+	}
+	if n := Regressions(Compare(baseline, current, 20, 10)); n != 0 {
+		t.Fatalf("regressions = %d within a loose tolerance, want 0", n)
+	}
+
+	var buf bytes.Buffer
+	FormatComparison(&buf, cmps, false, false)
+	for _, want := range []string{"Comparison:\n", "p99", "100ms", "105ms", "Status codes:", "regressed"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("comparison misses %q:\n%s", want, buf.String())
+		}
+	}
+	buf.Reset()
+	FormatComparison(&buf, cmps, false, true)
+	var got struct {
+		Comparison []struct {
+			Metric    string
+			Regressed bool
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil || len(got.Comparison) != len(cmps) {
+		t.Fatalf("json comparison = %v %+v:\n%s", err, got, buf.String())
+	}
+}
+
+func TestLoadExportedReport(t *testing.T) {
+	e := newTestExport(t)
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := WriteReportFile(path, "json", e); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadExportedReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Report.Count != 4 || len(loaded.Report.Percentiles) != len(e.Report.Percentiles) {
+		t.Fatalf("loaded report = %+v, want the written one", loaded.Report)
+	}
+	if n := Regressions(Compare(loaded.Report, e.Report, 0, 0)); n != 0 {
+		t.Fatalf("a report regressed %d times against itself", n)
+	}
+
+	if _, err := LoadExportedReport(writeDataFile(t, "report.json", "[1, 2]")); err == nil {
+		t.Fatal("LoadExportedReport accepted a file that isn't a report")
+	}
+	if _, err := parsePercent("ten"); err == nil {
+		t.Fatal("parsePercent accepted ten")
+	}
+	if v, err := parsePercent("2.5%"); err != nil || v != 2.5 {
+		t.Fatalf("parsePercent(2.5%%) = %v, %v", v, err)
+	}
+}
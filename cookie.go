@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	url2 "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// fileCookie is a cookie of a --cookie-file with the url it was set for.
+type fileCookie struct {
+	url    *url2.URL
+	cookie *http.Cookie
+}
+
+// LoadCookieFile reads a Netscape cookie file, as written by curl -c or
+// browser extensions.
+func LoadCookieFile(path string) ([]fileCookie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cookies []fileCookie
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s:%d: want 7 tab separated fields, got %d", path, lineNo, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid expiration %q", path, lineNo, fields[4])
+		}
+		host := strings.TrimPrefix(fields[0], ".")
+		u := &url2.URL{Scheme: "http", Host: host, Path: fields[2]}
+		c := &http.Cookie{Name: fields[5], Value: fields[6], Path: fields[2], HttpOnly: httpOnly}
+		if strings.EqualFold(fields[1], "TRUE") {
+			c.Domain = host
+		}
+		if strings.EqualFold(fields[3], "TRUE") {
+			c.Secure = true
+			u.Scheme = "https"
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, fileCookie{url: u, cookie: c})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cookies, nil
+}
+
+// cookieJar is the cookie jar of one worker, a nil jar does nothing.
+type cookieJar struct {
+	jar         *cookiejar.Jar
+	baseCookies [][2]string
+}
+
+// newCookieJar returns the jar of a worker, or nil without --cookies.
+func (r *Requester) newCookieJar() *cookieJar {
+	if !r.clientOpt.cookies {
+		return nil
+	}
+	jar, _ := cookiejar.New(nil)
+	for _, c := range r.fileCookies {
+		jar.SetCookies(c.url, []*http.Cookie{c.cookie})
+	}
+	return &cookieJar{jar: jar}
+}
+
+func requestURL(req *fasthttp.Request) *url2.URL {
+	u, _ := url2.Parse(string(req.URI().FullURI()))
+	return u
+}
+
+// addCookies replaces the cookies of req with the ones it was prepared
+// with and the ones of the jar for its url.
+func (j *cookieJar) addCookies(req *fasthttp.Request) {
+	if j == nil {
+		return
+	}
+	j.baseCookies = j.baseCookies[:0]
+	for k, v := range req.Header.Cookies() {
+		j.baseCookies = append(j.baseCookies, [2]string{string(k), string(v)})
+	}
+	j.setCookies(req)
+}
+
+// setCookies replaces the cookies of req, the last request added or one of
+// its redirects, with its base cookies and the ones of the jar for its url.
+func (j *cookieJar) setCookies(req *fasthttp.Request) {
+	if j == nil {
+		return
+	}
+	req.Header.DelAllCookies()
+	for _, c := range j.baseCookies {
+		req.Header.SetCookie(c[0], c[1])
+	}
+	u := requestURL(req)
+	if u == nil {
+		return
+	}
+	for _, c := range j.jar.Cookies(u) {
+		req.Header.SetCookie(c.Name, c.Value)
+	}
+}
+
+// resetCookies leaves req with the cookies it was prepared with, a worker
+// may send it again.
+func (j *cookieJar) resetCookies(req *fasthttp.Request) {
+	if j == nil {
+		return
+	}
+	req.Header.DelAllCookies()
+	for _, c := range j.baseCookies {
+		req.Header.SetCookie(c[0], c[1])
+	}
+}
+
+// storeCookies keeps the Set-Cookie headers of resp.
+func (j *cookieJar) storeCookies(req *fasthttp.Request, resp *fasthttp.Response) {
+	if j == nil {
+		return
+	}
+	var cookies []*http.Cookie
+	for _, v := range resp.Header.Cookies() {
+		if c, err := http.ParseSetCookie(string(v)); err == nil {
+			cookies = append(cookies, c)
+		}
+	}
+	if len(cookies) == 0 {
+		return
+	}
+	if u := requestURL(req); u != nil {
+		j.jar.SetCookies(u, cookies)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestLoadCookieFile(t *testing.T) {
+	path := writeDataFile(t, "cookies.txt", "# Netscape HTTP Cookie File\n\n"+
+		".example.com\tTRUE\t/\tFALSE\t0\tsid\tabc\n"+
+		"#HttpOnly_api.example.com\tFALSE\t/v1\tTRUE\t2000000000\ttoken\txyz\n")
+	cookies, err := LoadCookieFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("%d cookies, want 2", len(cookies))
+	}
+	if c := cookies[0]; c.url.String() != "http://example.com/" || c.cookie.Name != "sid" || c.cookie.Value != "abc" || c.cookie.Domain != "example.com" || !c.cookie.Expires.IsZero() {
+		t.Fatalf("first cookie = %s %+v", c.url, c.cookie)
+	}
+	if c := cookies[1]; c.url.String() != "https://api.example.com/v1" || !c.cookie.HttpOnly || !c.cookie.Secure || c.cookie.Domain != "" || c.cookie.Expires.Unix() != 2000000000 {
+		t.Fatalf("second cookie = %s %+v", c.url, c.cookie)
+	}
+
+	for name, content := range map[string]string{
+		"fields":     "example.com\tFALSE\t/\tFALSE\t0\tsid\n",
+		"expiration": "example.com\tFALSE\t/\tFALSE\tnever\tsid\tabc\n",
+	} {
+		if _, err := LoadCookieFile(writeDataFile(t, "cookies.txt", content)); err == nil {
+			t.Fatalf("%s: LoadCookieFile succeeded, want error", name)
+		}
+	}
+}
+
+// startSessionServer starts a session on the first request of every client
+// and returns the Cookie headers it received.
+func startSessionServer(t *testing.T) (string, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []string
+	sessions := 0
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, string(ctx.Request.Header.Peek("Cookie")))
+		if len(ctx.Request.Header.Cookie("sid")) == 0 {
+			sessions++
+			ctx.Response.Header.Add("Set-Cookie", "sid=s"+strconv.Itoa(sessions)+"; Path=/; HttpOnly")
+			ctx.Response.Header.Add("Set-Cookie", "lang=en; Path=/")
+		}
+	})
+	return "http://" + addr, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), got...)
+	}
+}
+
+func TestCookieJarPerWorker(t *testing.T) {
+	url, cookies := startSessionServer(t)
+	requester, err := NewRequester(2, 10, 0, nil, io.Discard, &ClientOpt{
+		url:         url,
+		method:      fasthttp.MethodGet,
+		headers:     []string{"Cookie: theme=dark"},
+		cookies:     true,
+		maxConns:    2,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectRecords(t, requester)
+
+	got := cookies()
+	if len(got) != 10 {
+		t.Fatalf("%d requests, want 10", len(got))
+	}
+	fresh := 0
+	sessions := map[string]int{}
+	for _, c := range got {
+		if !strings.HasPrefix(c, "theme=dark") {
+			t.Fatalf("Cookie = %q, want the -H cookie first", c)
+		}
+		if c == "theme=dark" {
+			fresh++
+			continue
+		}
+		if !strings.Contains(c, "lang=en") {
+			t.Fatalf("Cookie = %q, want every stored cookie", c)
+		}
+		sessions[c]++
+	}
+	if len(sessions) != 2 || fresh != 2 {
+		t.Fatalf("cookies = %v, want one session per worker", got)
+	}
+}
+
+func TestCookieFileSeedsTheJars(t *testing.T) {
+	url, cookies := startSessionServer(t)
+	host, _, _ := net.SplitHostPort(strings.TrimPrefix(url, "http://"))
+	path := writeDataFile(t, "cookies.txt", host+"\tFALSE\t/\tFALSE\t0\tsid\tsaved\n")
+	requester, err := NewRequester(1, 3, 0, nil, io.Discard, &ClientOpt{
+		url:         url,
+		method:      fasthttp.MethodGet,
+		cookieFile:  path,
+		maxConns:    1,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectRecords(t, requester)
+	for _, c := range cookies() {
+		if c != "sid=saved" {
+			t.Fatalf("Cookie = %q, want the cookie of the file", c)
+		}
+	}
+
+	if _, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: "ws://127.0.0.1:1/", cookies: true}, -1); err == nil {
+		t.Fatal("NewRequester accepted --cookies with a websocket url")
+	}
+}
+
+func TestCookieJarKeepsTheCookiesOfEveryRequest(t *testing.T) {
+	url, cookies := startSessionServer(t)
+	path := writeRequestsFile(t, `{"url": "/one", "headers": {"Cookie": "theme=dark"}}
+{"url": "/two", "headers": {"Cookie": "theme=light"}}
+`)
+	requester, err := NewRequester(1, 4, 0, nil, io.Discard, &ClientOpt{
+		url:          url,
+		method:       fasthttp.MethodGet,
+		requestsFile: path,
+		requestsMode: "round-robin",
+		cookies:      true,
+		maxConns:     1,
+		dialTimeout:  time.Second,
+		doTimeout:    time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectRecords(t, requester)
+
+	want := []string{"theme=dark", "theme=light; sid=s1; lang=en", "theme=dark; sid=s1; lang=en", "theme=light; sid=s1; lang=en"}
+	if got := cookies(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("cookies = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var dataModes = []string{"sequential", "random", "unique"}
+
+// errDataExhausted is returned when --data-stop is set and every row of
+// --data has been used.
+var errDataExhausted = errors.New("--data is exhausted")
+
+// DataSet holds the rows of a --data file, every request takes one row and
+// reads its columns with {{data "COLUMN"}}.
+type DataSet struct {
+	columns map[string]int
+	rows    [][]string
+	mode    string
+	stop    bool
+
+	cursor uint64
+
+	mu    sync.Mutex
+	order []int
+	pos   int
+}
+
+// LoadDataFile reads a CSV file with a header line, or a JSON Lines file of
+// objects when the extension is .jsonl or .ndjson.
+func LoadDataFile(path, mode string, stop bool) (*DataSet, error) {
+	if mode == "random" && stop {
+		return nil, errors.New("--data-stop can't be used with --data-mode random")
+	}
+	var (
+		d   *DataSet
+		err error
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		d, err = loadDataJSONL(path)
+	default:
+		d, err = loadDataCSV(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(d.rows) == 0 {
+		return nil, fmt.Errorf("%s: no rows found", path)
+	}
+	d.mode, d.stop = mode, stop
+	return d, nil
+}
+
+func loadDataCSV(path string) (*DataSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: no header line found", path)
+	}
+	d := &DataSet{columns: map[string]int{}, rows: records[1:]}
+	for i, name := range records[0] {
+		d.columns[strings.TrimSpace(name)] = i
+	}
+	return d, nil
+}
+
+func loadDataJSONL(path string) (*DataSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var objects []map[string]json.RawMessage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(line, &obj); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		objects = append(objects, obj)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	d := &DataSet{columns: map[string]int{}}
+	var names []string
+	for _, obj := range objects {
+		for k := range obj {
+			if _, ok := d.columns[k]; !ok {
+				d.columns[k] = -1
+				names = append(names, k)
+			}
+		}
+	}
+	sort.Strings(names)
+	for i, k := range names {
+		d.columns[k] = i
+	}
+	for _, obj := range objects {
+		row := make([]string, len(names))
+		for k, v := range obj {
+			// strings are used unquoted, other values as JSON
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				s = string(v)
+			}
+			row[d.columns[k]] = s
+		}
+		d.rows = append(d.rows, row)
+	}
+	return d, nil
+}
+
+func (d *DataSet) Len() int {
+	return len(d.rows)
+}
+
+// Next returns the row of the next request, or errDataExhausted.
+func (d *DataSet) Next(rnd *rand.Rand) ([]string, error) {
+	switch d.mode {
+	case "random":
+		return d.rows[rnd.Intn(len(d.rows))], nil
+	case "unique":
+		// a shuffled order, rows are used once per pass
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.order == nil || d.pos == len(d.order) {
+			if d.order != nil && d.stop {
+				return nil, errDataExhausted
+			}
+			d.order = rnd.Perm(len(d.rows))
+			d.pos = 0
+		}
+		row := d.rows[d.order[d.pos]]
+		d.pos++
+		return row, nil
+	}
+	i := atomic.AddUint64(&d.cursor, 1) - 1
+	if d.stop && i >= uint64(len(d.rows)) {
+		return nil, errDataExhausted
+	}
+	return d.rows[i%uint64(len(d.rows))], nil
+}
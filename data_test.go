@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func writeDataFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDataFile(t *testing.T) {
+	csvPath := writeDataFile(t, "users.csv", "id,token\n1,a\n2,b\n")
+	d, err := LoadDataFile(csvPath, "sequential", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Len() != 2 || d.columns["token"] != 1 || d.rows[1][1] != "b" {
+		t.Fatalf("csv data = %+v, want 2 rows of id,token", d)
+	}
+
+	jsonlPath := writeDataFile(t, "users.jsonl", `
+# comments and blank lines are skipped
+{"id": 1, "name": "alice"}
+
+{"id": 2, "tags": ["x"]}
+`)
+	d, err = LoadDataFile(jsonlPath, "sequential", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Len() != 2 {
+		t.Fatalf("jsonl rows = %d, want 2", d.Len())
+	}
+	row := d.rows[0]
+	if row[d.columns["id"]] != "1" || row[d.columns["name"]] != "alice" || row[d.columns["tags"]] != "" {
+		t.Fatalf("jsonl row = %v, want strings unquoted and missing keys empty", row)
+	}
+	if got := d.rows[1][d.columns["tags"]]; got != `["x"]` {
+		t.Fatalf("tags = %q, want the JSON value", got)
+	}
+
+	for name, path := range map[string]string{
+		"missing":      filepath.Join(t.TempDir(), "missing.csv"),
+		"no rows":      writeDataFile(t, "empty.csv", "id\n"),
+		"invalid json": writeDataFile(t, "bad.jsonl", "{\"id\": 1\n"),
+	} {
+		if _, err := LoadDataFile(path, "sequential", false); err == nil {
+			t.Fatalf("%s: LoadDataFile succeeded, want error", name)
+		}
+	}
+	if _, err := LoadDataFile(csvPath, "random", true); err == nil {
+		t.Fatal("LoadDataFile accepted --data-stop with random mode")
+	}
+}
+
+func nextDataRows(t *testing.T, d *DataSet, n int) ([]string, error) {
+	t.Helper()
+	rnd := rand.New(rand.NewSource(1))
+	var got []string
+	for i := 0; i < n; i++ {
+		row, err := d.Next(rnd)
+		if err != nil {
+			return got, err
+		}
+		got = append(got, row[0])
+	}
+	return got, nil
+}
+
+func TestDataSetModes(t *testing.T) {
+	path := writeDataFile(t, "ids.csv", "id\n1\n2\n3\n")
+
+	d, _ := LoadDataFile(path, "sequential", false)
+	if got, _ := nextDataRows(t, d, 4); strings.Join(got, ",") != "1,2,3,1" {
+		t.Fatalf("sequential rows = %v, want 1,2,3,1", got)
+	}
+
+	d, _ = LoadDataFile(path, "sequential", true)
+	if got, err := nextDataRows(t, d, 4); err != errDataExhausted || strings.Join(got, ",") != "1,2,3" {
+		t.Fatalf("sequential rows with stop = %v, %v, want 1,2,3 then exhausted", got, err)
+	}
+
+	d, _ = LoadDataFile(path, "unique", true)
+	got, err := nextDataRows(t, d, 4)
+	if err != errDataExhausted || len(got) != 3 {
+		t.Fatalf("unique rows with stop = %v, %v, want 3 rows then exhausted", got, err)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "1,2,3" {
+		t.Fatalf("unique rows = %v, want each row once", got)
+	}
+
+	d, _ = LoadDataFile(path, "unique", false)
+	if got, err := nextDataRows(t, d, 6); err != nil || len(got) != 6 {
+		t.Fatalf("unique rows = %v, %v, want a second pass", got, err)
+	}
+
+	d, _ = LoadDataFile(path, "random", false)
+	got, _ = nextDataRows(t, d, 20)
+	for _, id := range got {
+		if id != "1" && id != "2" && id != "3" {
+			t.Fatalf("random row = %q, want one of the rows", id)
+		}
+	}
+}
+
+func TestRequesterStopsWhenDataIsExhausted(t *testing.T) {
+	t.Run("body", func(t *testing.T) { testStopsWhenDataIsExhausted(t, "") })
+	// the rows are taken with a streamed body too
+	t.Run("body file", func(t *testing.T) {
+		testStopsWhenDataIsExhausted(t, writeDataFile(t, "body.json", "{}"))
+	})
+}
+
+func testStopsWhenDataIsExhausted(t *testing.T, bodyFile string) {
+	var mu sync.Mutex
+	var got []string
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		got = append(got, string(ctx.Path())+" "+string(ctx.Request.Header.Peek("Authorization")))
+		mu.Unlock()
+	})
+
+	data, err := LoadDataFile(writeDataFile(t, "users.csv", "id,token\n1,a\n2,b\n3,c\n"), "unique", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requester, err := NewRequester(2, -1, 0, nil, io.Discard, &ClientOpt{
+		url:         "http://" + addr + `/users/{{data "id"}}`,
+		method:      fasthttp.MethodGet,
+		headers:     []string{`Authorization: Bearer {{data "token"}}`},
+		bodyFile:    bodyFile,
+		data:        data,
+		maxConns:    2,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := len(collectRecords(t, requester))
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(got)
+	if records != 3 || strings.Join(got, ",") != "/users/1 Bearer a,/users/2 Bearer b,/users/3 Bearer c" {
+		t.Fatalf("%d records, server got %v, want each row once", records, got)
+	}
+}
+
+func TestH2ClientSendsTheDataRows(t *testing.T) {
+	handler := &h2TestHandler{}
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	data, err := LoadDataFile(writeDataFile(t, "users.csv", "id\n1\n2\n"), "sequential", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runH2Requester(t, &ClientOpt{
+		url:          server.URL + `/users/{{data "id"}}`,
+		data:         data,
+		insecure:     true,
+		h2Conns:      1,
+		h2MaxStreams: 1,
+	}, 1, 3)
+
+	if got := strings.Join(handler.paths, ","); got != "/users/1,/users/2,/users/1" {
+		t.Fatalf("server got %s, want the rows in order", got)
+	}
+}
+
+func TestDataRequiresTemplate(t *testing.T) {
+	data, err := LoadDataFile(writeDataFile(t, "ids.csv", "id\n1\n"), "sequential", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opt := range []*ClientOpt{
+		{url: "http://127.0.0.1/", data: data},
+		{url: `http://127.0.0.1/{{data "nope"}}`, data: data},
+		{url: `http://127.0.0.1/{{data "id"}}`},
+	} {
+		if _, err := newRequestTemplates(opt); err == nil {
+			t.Fatalf("newRequestTemplates(%s) succeeded, want error", opt.url)
+		}
+	}
+}
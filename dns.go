@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var dnsModes = []string{"per-conn", "once"}
+
+// resolver picks the address of every new connection from the --resolve
+// pins, or a lookup on --dns-server or the system resolver. With --dns-mode
+// once a host is looked up a single time and all its connections go to the
+// same address, otherwise the connections go round the addresses of a new
+// lookup each. The host of the url stays the SNI and the Host header.
+type resolver struct {
+	pins    map[string]string
+	lookup  *net.Resolver
+	once    bool
+	timeout time.Duration
+	next    uint32
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// parseResolve parses curl style HOST:PORT:ADDR pins.
+func parseResolve(pins []string) (map[string]string, error) {
+	res := make(map[string]string, len(pins))
+	for _, pin := range pins {
+		host, rest, ok := strings.Cut(pin, ":")
+		if strings.HasPrefix(pin, "[") {
+			host, rest, ok = strings.Cut(pin[1:], "]:")
+		}
+		port, addr, found := strings.Cut(rest, ":")
+		if !ok || !found || host == "" || port == "" {
+			return nil, fmt.Errorf("invalid --resolve %q, want HOST:PORT:ADDR", pin)
+		}
+		ip := strings.Trim(addr, "[]")
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid --resolve %q, %q is not an ip address", pin, addr)
+		}
+		res[net.JoinHostPort(host, port)] = ip
+	}
+	return res, nil
+}
+
+// newResolver returns nil when the system resolver of the dialer is enough.
+func newResolver(opt *ClientOpt) (*resolver, error) {
+	if len(opt.resolve) == 0 && opt.dnsServer == "" && opt.dnsMode != "once" {
+		return nil, nil
+	}
+	pins, err := parseResolve(opt.resolve)
+	if err != nil {
+		return nil, err
+	}
+	rs := &resolver{
+		pins:    pins,
+		lookup:  net.DefaultResolver,
+		once:    opt.dnsMode == "once",
+		timeout: opt.dialTimeout,
+		cache:   make(map[string]string),
+	}
+	if opt.dnsServer != "" {
+		server := opt.dnsServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		rs.lookup = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return rs, nil
+}
+
+// resolve returns the ip:port to connect to for the host:port addr.
+func (rs *resolver) resolve(addr string) (string, error) {
+	if ip, ok := rs.pins[addr]; ok {
+		_, port, _ := net.SplitHostPort(addr)
+		return net.JoinHostPort(ip, port), nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	if rs.once {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		if resolved, ok := rs.cache[addr]; ok {
+			return resolved, nil
+		}
+	}
+
+	ctx := context.Background()
+	if rs.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rs.timeout)
+		defer cancel()
+	}
+	ips, err := rs.lookup.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no address found for %s", host)
+	}
+	i := 0
+	if !rs.once {
+		i = int(atomic.AddUint32(&rs.next, 1)-1) % len(ips)
+	}
+	resolved := net.JoinHostPort(ips[i].IP.String(), port)
+	if rs.once {
+		rs.cache[addr] = resolved
+	}
+	return resolved, nil
+}
+
+// wrap makes dial connect to the resolved address.
+func (rs *resolver) wrap(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		resolved, err := rs.resolve(addr)
+		if err != nil {
+			return nil, err
+		}
+		return dial(resolved)
+	}
+}
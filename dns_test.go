@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseResolve(t *testing.T) {
+	pins, err := parseResolve([]string{"example.com:443:10.0.0.1", "[::1]:80:[2001:db8::1]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pins["example.com:443"] != "10.0.0.1" || pins["[::1]:80"] != "2001:db8::1" {
+		t.Fatalf("pins = %v", pins)
+	}
+	for _, pin := range []string{"example.com:443", "example.com::10.0.0.1", "example.com:443:node1"} {
+		if _, err := parseResolve([]string{pin}); err == nil {
+			t.Fatalf("parseResolve(%q) succeeded, want error", pin)
+		}
+	}
+}
+
+func TestResolvePinsTheConnections(t *testing.T) {
+	hosts := make(chan string, 10)
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		hosts <- string(ctx.Host())
+	})
+
+	_, port, _ := net.SplitHostPort(addr)
+	requester, err := NewRequester(1, 2, 0, nil, io.Discard, &ClientOpt{
+		url:         "http://node.plow.invalid:" + port + "/",
+		method:      fasthttp.MethodGet,
+		resolve:     []string{"node.plow.invalid:" + port + ":127.0.0.1"},
+		maxConns:    1,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rr := range collectRecords(t, requester) {
+		if rr.code != fasthttp.StatusOK {
+			t.Fatalf("record = code %d error %q, want 200", rr.code, rr.error)
+		}
+	}
+	if host := <-hosts; host != "node.plow.invalid:"+port {
+		t.Fatalf("Host = %q, want the host of the url", host)
+	}
+
+	if _, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: "http://example.com/", resolve: []string{"example.com:80"}}, -1); err == nil {
+		t.Fatal("NewRequester accepted an invalid --resolve")
+	}
+}
+
+// startDNSServer answers every A query with addrs.
+func startDNSServer(t *testing.T, addrs ...[4]byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+				continue
+			}
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true},
+				Questions: req.Questions,
+			}
+			if q.Type == dnsmessage.TypeA {
+				for _, a := range addrs {
+					resp.Answers = append(resp.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: a},
+					})
+				}
+			}
+			b, _ := resp.Pack()
+			_, _ = conn.WriteTo(b, from)
+		}
+	}()
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn.LocalAddr().String()
+}
+
+func TestResolverModes(t *testing.T) {
+	server := startDNSServer(t, [4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2})
+	for mode, want := range map[string]int{"per-conn": 2, "once": 1} {
+		rs, err := newResolver(&ClientOpt{dnsServer: server, dnsMode: mode, dialTimeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := map[string]bool{}
+		for i := 0; i < 4; i++ {
+			addr, err := rs.resolve("node.plow.test:8080")
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen[addr] = true
+		}
+		if len(seen) != want || !(seen["10.0.0.1:8080"] || seen["10.0.0.2:8080"]) {
+			t.Fatalf("%s: connections went to %v, want %d of the addresses", mode, seen, want)
+		}
+	}
+
+	if rs, _ := newResolver(&ClientOpt{dnsMode: "per-conn"}); rs != nil {
+		t.Fatal("newResolver = a resolver, want nil without --resolve, --dns-server or --dns-mode once")
+	}
+}
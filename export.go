@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var reportFormats = []string{"json", "csv", "junit", "markdown", "html"}
+
+// RunConfig is the configuration of a run, written along its final report.
+type RunConfig struct {
+	Description string
+	URLs        []string
+	Method      string
+	Concurrency int
+	Requests    int64
+	Duration    time.Duration
+	// Rate is in requests per second, 0 without --rate
+	Rate    float64
+	Timeout time.Duration
+	Started time.Time
+	Version string
+}
+
+// ExportedThreshold is the result of a --threshold in the exported report.
+type ExportedThreshold struct {
+	Expr   string
+	Actual float64
+	Pass   bool
+	actual string
+}
+
+// ExportedReport is what --report-out writes, the durations are in
+// nanoseconds.
+type ExportedReport struct {
+	Config     *RunConfig
+	Report     *SnapshotReport
+	Thresholds []*ExportedThreshold `json:",omitempty"`
+}
+
+func NewExportedReport(config *RunConfig, snapshot *SnapshotReport, thresholds []*Threshold) *ExportedReport {
+	e := &ExportedReport{Config: config, Report: snapshot}
+	results, _ := CheckThresholds(thresholds, snapshot)
+	for _, r := range results {
+		e.Thresholds = append(e.Thresholds, &ExportedThreshold{r.expr, r.Actual, r.Pass, r.ActualString(false)})
+	}
+	return e
+}
+
+// WriteReportFile writes the report to path in one of reportFormats.
+func WriteReportFile(path, format string, e *ExportedReport) error {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "json":
+		err = e.writeJSON(&buf)
+	case "csv":
+		err = e.writeCSV(&buf)
+	case "junit":
+		err = e.writeJUnit(&buf)
+	case "markdown":
+		e.writeMarkdown(&buf)
+	case "html":
+		e.writeHTML(&buf)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func (e *ExportedReport) writeJSON(buf *bytes.Buffer) error {
+	enc := json.NewEncoder(buf)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func percentileName(p float64) string {
+	return "p" + formatFloat64(p*100)
+}
+
+// rows returns the report as metric, key, value rows, the durations are in
+// nanoseconds.
+func (e *ExportedReport) rows() [][]string {
+	c, s := e.Config, e.Report
+	rows := [][]string{
+		{"config", "description", c.Description},
+		{"config", "url", strings.Join(c.URLs, " ")},
+		{"config", "method", c.Method},
+		{"config", "concurrency", strconv.Itoa(c.Concurrency)},
+		{"config", "requests", strconv.FormatInt(c.Requests, 10)},
+		{"config", "duration", strconv.FormatInt(int64(c.Duration), 10)},
+		{"config", "rate", formatFloat64(c.Rate)},
+		{"config", "timeout", strconv.FormatInt(int64(c.Timeout), 10)},
+		{"config", "started", c.Started.Format(time.RFC3339)},
+		{"config", "version", c.Version},
+		{"elapsed", "", strconv.FormatInt(int64(s.Elapsed), 10)},
+		{"count", "", strconv.FormatInt(s.Count, 10)},
+		{"rps", "", formatFloat64(s.RPS)},
+		{"reads_mb_per_sec", "", formatFloat64(s.ReadThroughput)},
+		{"writes_mb_per_sec", "", formatFloat64(s.WriteThroughput)},
+	}
+	if s.Stats != nil {
+		rows = append(rows,
+			[]string{"latency", "min", strconv.FormatInt(int64(s.Stats.Min), 10)},
+			[]string{"latency", "mean", strconv.FormatInt(int64(s.Stats.Mean), 10)},
+			[]string{"latency", "stddev", strconv.FormatInt(int64(s.Stats.StdDev), 10)},
+			[]string{"latency", "max", strconv.FormatInt(int64(s.Stats.Max), 10)},
+		)
+	}
+	for _, p := range s.Percentiles {
+		rows = append(rows, []string{"latency", percentileName(p.Percentile), strconv.FormatInt(int64(p.Latency), 10)})
+	}
+	for _, k := range sortedKeys(s.StatusCodes) {
+		rows = append(rows, []string{"status", k, strconv.FormatInt(s.StatusCodes[k], 10)})
+	}
+	for _, k := range sortedKeys(s.Redirects) {
+		rows = append(rows, []string{"redirect", k, strconv.FormatInt(s.Redirects[k], 10)})
+	}
+	for _, k := range sortedKeys(s.Errors) {
+		rows = append(rows, []string{"error", k, strconv.FormatInt(s.Errors[k], 10)})
+	}
+	if conns := s.Connections; conns != nil {
+		rows = append(rows,
+			[]string{"connections", "opened", strconv.FormatInt(conns.Opened, 10)},
+			[]string{"connections", "closed", strconv.FormatInt(conns.Closed, 10)},
+			[]string{"connections", "reused", strconv.FormatInt(conns.Reused, 10)},
+			[]string{"connections", "failed", strconv.FormatInt(conns.Failed, 10)},
+		)
+	}
+	for _, l := range s.Labels {
+		rows = append(rows,
+			[]string{"label_count", l.Label, strconv.FormatInt(l.Count, 10)},
+			[]string{"label_rps", l.Label, formatFloat64(l.RPS)},
+			[]string{"label_mean", l.Label, strconv.FormatInt(int64(l.Stats.Mean), 10)},
+		)
+		for _, p := range l.Percentiles {
+			rows = append(rows, []string{"label_" + percentileName(p.Percentile), l.Label, strconv.FormatInt(int64(p.Latency), 10)})
+		}
+	}
+	for _, t := range s.Timings {
+		rows = append(rows, []string{"timing_mean", t.Label, strconv.FormatInt(int64(t.Stats.Mean), 10)})
+	}
+	for _, t := range e.Thresholds {
+		pass := "pass"
+		if !t.Pass {
+			pass = "fail"
+		}
+		rows = append(rows, []string{"threshold", t.Expr, pass})
+	}
+	return rows
+}
+
+func (e *ExportedReport) writeCSV(buf *bytes.Buffer) error {
+	w := csv.NewWriter(buf)
+	_ = w.Write([]string{"metric", "key", "value"})
+	_ = w.WriteAll(e.rows())
+	return w.Error()
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName    xml.Name        `xml:"testsuite"`
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+// writeJUnit writes every --threshold as a test case, and the report as the
+// properties of the suite.
+func (e *ExportedReport) writeJUnit(buf *bytes.Buffer) error {
+	elapsed := strconv.FormatFloat(e.Report.Elapsed.Seconds(), 'f', 3, 64)
+	suite := junitTestSuite{
+		Name:      "plow",
+		Tests:     len(e.Thresholds),
+		Time:      elapsed,
+		Timestamp: e.Config.Started.Format("2006-01-02T15:04:05"),
+	}
+	for _, row := range e.rows() {
+		if row[0] == "threshold" {
+			continue
+		}
+		name := row[0]
+		if row[1] != "" {
+			name += "." + row[1]
+		}
+		suite.Properties = append(suite.Properties, junitProperty{name, row[2]})
+	}
+	for _, t := range e.Thresholds {
+		tc := junitTestCase{Name: t.Expr, ClassName: "plow.threshold", Time: elapsed}
+		if !t.Pass {
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: fmt.Sprintf("%s, actual %s", t.Expr, t.actual)}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	return nil
+}
+
+// reportTable is a section of the markdown and html reports.
+type reportTable struct {
+	title  string
+	header []string
+	rows   [][]string
+}
+
+func (e *ExportedReport) tables() []reportTable {
+	c, s := e.Config, e.Report
+	ms := func(d time.Duration) string { return durationToString(d, false) }
+	summary := reportTable{title: "Summary", header: []string{"Metric", "Value"}, rows: [][]string{
+		{"URL", strings.Join(c.URLs, " ")},
+		{"Method", c.Method},
+		{"Concurrency", strconv.Itoa(c.Concurrency)},
+		{"Started", c.Started.Format(time.RFC3339)},
+		{"Elapsed", ms(s.Elapsed)},
+		{"Count", strconv.FormatInt(s.Count, 10)},
+		{"RPS", fmt.Sprintf("%.3f", s.RPS)},
+		{"Reads", fmt.Sprintf("%.3fMB/s", s.ReadThroughput)},
+		{"Writes", fmt.Sprintf("%.3fMB/s", s.WriteThroughput)},
+	}}
+	if conns := s.Connections; conns != nil {
+		summary.rows = append(summary.rows, []string{"Connections", fmt.Sprintf("%d opened, %d closed, %d reused, %d failed",
+			conns.Opened, conns.Closed, conns.Reused, conns.Failed)})
+	}
+	tables := []reportTable{summary}
+
+	if s.Stats != nil {
+		latency := reportTable{title: "Latency", header: []string{"Min", "Mean", "StdDev", "Max"}}
+		latency.rows = [][]string{{ms(s.Stats.Min), ms(s.Stats.Mean), ms(s.Stats.StdDev), ms(s.Stats.Max)}}
+		for _, p := range s.Percentiles {
+			latency.header = append(latency.header, strings.ToUpper(percentileName(p.Percentile)))
+			latency.rows[0] = append(latency.rows[0], ms(p.Latency))
+		}
+		tables = append(tables, latency)
+	}
+	codes := reportTable{title: "Status codes", header: []string{"Status", "Count"}}
+	for _, k := range sortedKeys(s.StatusCodes) {
+		codes.rows = append(codes.rows, []string{k, strconv.FormatInt(s.StatusCodes[k], 10)})
+	}
+	for _, k := range sortedKeys(s.Redirects) {
+		codes.rows = append(codes.rows, []string{k + " (redirect)", strconv.FormatInt(s.Redirects[k], 10)})
+	}
+	tables = append(tables, codes)
+	if len(s.Errors) > 0 {
+		errs := reportTable{title: "Errors", header: []string{"Error", "Count"}}
+		for _, k := range sortedKeys(s.Errors) {
+			errs.rows = append(errs.rows, []string{k, strconv.FormatInt(s.Errors[k], 10)})
+		}
+		tables = append(tables, errs)
+	}
+	for _, section := range []struct {
+		title  string
+		labels []*LabelSnapshot
+	}{{"Labels", s.Labels}, {"Timings", s.Timings}} {
+		if len(section.labels) == 0 {
+			continue
+		}
+		t := reportTable{title: section.title, header: []string{"Label", "Count", "RPS", "Mean"}}
+		for _, p := range section.labels[0].Percentiles {
+			t.header = append(t.header, strings.ToUpper(percentileName(p.Percentile)))
+		}
+		for _, l := range section.labels {
+			row := []string{l.Label, strconv.FormatInt(l.Count, 10), fmt.Sprintf("%.3f", l.RPS), ms(l.Stats.Mean)}
+			for _, p := range l.Percentiles {
+				row = append(row, ms(p.Latency))
+			}
+			t.rows = append(t.rows, row)
+		}
+		tables = append(tables, t)
+	}
+	if len(e.Thresholds) > 0 {
+		thresholds := reportTable{title: "Thresholds", header: []string{"Threshold", "Actual", "Result"}}
+		for _, t := range e.Thresholds {
+			result := "pass"
+			if !t.Pass {
+				result = "FAIL"
+			}
+			thresholds.rows = append(thresholds.rows, []string{t.Expr, t.actual, result})
+		}
+		tables = append(tables, thresholds)
+	}
+	return tables
+}
+
+func (e *ExportedReport) writeMarkdown(buf *bytes.Buffer) {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+	fmt.Fprintf(buf, "# %s\n", escape.Replace(e.Config.Description))
+	for _, t := range e.tables() {
+		fmt.Fprintf(buf, "\n## %s\n\n", t.title)
+		buf.WriteString("| " + strings.Join(t.header, " | ") + " |\n")
+		buf.WriteString("|" + strings.Repeat(" --- |", len(t.header)) + "\n")
+		for _, row := range t.rows {
+			cells := make([]string, len(row))
+			for i, cell := range row {
+				cells[i] = escape.Replace(cell)
+			}
+			buf.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		}
+	}
+}
+
+func (e *ExportedReport) writeHTML(buf *bytes.Buffer) {
+	title := html.EscapeString(e.Config.Description)
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(buf, "<title>%s</title>\n", title)
+	buf.WriteString("<style>body{font-family:sans-serif}table{border-collapse:collapse}th,td{border:1px solid #ccc;padding:4px 8px;text-align:right}th:first-child,td:first-child{text-align:left}</style>\n")
+	fmt.Fprintf(buf, "</head>\n<body>\n<h1>%s</h1>\n", title)
+	for _, t := range e.tables() {
+		fmt.Fprintf(buf, "<h2>%s</h2>\n<table>\n<tr>", html.EscapeString(t.title))
+		for _, h := range t.header {
+			fmt.Fprintf(buf, "<th>%s</th>", html.EscapeString(h))
+		}
+		buf.WriteString("</tr>\n")
+		for _, row := range t.rows {
+			buf.WriteString("<tr>")
+			for _, cell := range row {
+				fmt.Fprintf(buf, "<td>%s</td>", html.EscapeString(cell))
+			}
+			buf.WriteString("</tr>\n")
+		}
+		buf.WriteString("</table>\n")
+	}
+	buf.WriteString("</body>\n</html>\n")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestExport(t *testing.T) *ExportedReport {
+	t.Helper()
+	records := make(chan *ReportRecord, 4)
+	records <- &ReportRecord{cost: 2 * time.Millisecond, code: 200}
+	records <- &ReportRecord{cost: 4 * time.Millisecond, code: 200}
+	records <- &ReportRecord{cost: 6 * time.Millisecond, code: 429}
+	records <- &ReportRecord{cost: 8 * time.Millisecond, error: "dial tcp: <refused>, again"}
+	close(records)
+	report := NewStreamReport()
+	report.Collect(records)
+
+	var thresholds []*Threshold
+	for _, expr := range []string{"p50<1s", "error_rate<1%"} {
+		th, err := ParseThreshold(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thresholds = append(thresholds, th)
+	}
+	return NewExportedReport(&RunConfig{
+		Description: "Benchmarking <test>",
+		URLs:        []string{"http://127.0.0.1:8080/"},
+		Method:      "GET",
+		Concurrency: 2,
+		Requests:    4,
+		Started:     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}, report.Snapshot(), thresholds)
+}
+
+func writeTestReport(t *testing.T, e *ExportedReport, format string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "report."+format)
+	if err := WriteReportFile(path, format, e); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestReportOutJSON(t *testing.T) {
+	var got struct {
+		Config struct {
+			Concurrency int
+		}
+		Report struct {
+			Count       int64
+			StatusCodes map[string]int64
+			Errors      map[string]int64
+			Stats       struct{ Max int64 }
+		}
+		Thresholds []struct {
+			Expr string
+			Pass bool
+		}
+	}
+	if err := json.Unmarshal([]byte(writeTestReport(t, newTestExport(t), "json")), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Config.Concurrency != 2 || got.Report.Count != 4 {
+		t.Fatalf("config and count = %+v", got)
+	}
+	if got.Report.StatusCodes["200"] != 2 || got.Report.StatusCodes["429"] != 1 || len(got.Report.Errors) != 1 {
+		t.Fatalf("codes %v errors %v, want every status and error", got.Report.StatusCodes, got.Report.Errors)
+	}
+	if got.Report.Stats.Max != int64(8*time.Millisecond) {
+		t.Fatalf("max = %d, want the nanoseconds", got.Report.Stats.Max)
+	}
+	if len(got.Thresholds) != 2 || !got.Thresholds[0].Pass || got.Thresholds[1].Pass {
+		t.Fatalf("thresholds = %+v, want p50 to pass and error_rate to fail", got.Thresholds)
+	}
+}
+
+func TestReportOutCSV(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(writeTestReport(t, newTestExport(t), "csv"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	for _, row := range rows[1:] {
+		values[row[0]+"/"+row[1]] = row[2]
+	}
+	for key, want := range map[string]string{
+		"count/":                           "4",
+		"status/429":                       "1",
+		"error/dial tcp: <refused>, again": "1",
+		"latency/max":                      "8000000",
+		"threshold/error_rate<1%":          "fail",
+		"config/url":                       "http://127.0.0.1:8080/",
+	} {
+		if values[key] != want {
+			t.Fatalf("%s = %q, want %q", key, values[key], want)
+		}
+	}
+}
+
+func TestReportOutJUnit(t *testing.T) {
+	var suite junitTestSuite
+	if err := xml.Unmarshal([]byte(writeTestReport(t, newTestExport(t), "junit")), &suite); err != nil {
+		t.Fatal(err)
+	}
+	if suite.Tests != 2 || suite.Failures != 1 || len(suite.TestCases) != 2 {
+		t.Fatalf("suite = %d tests %d failures, want 2 and 1", suite.Tests, suite.Failures)
+	}
+	if suite.TestCases[0].Failure != nil || suite.TestCases[1].Failure == nil || !strings.Contains(suite.TestCases[1].Failure.Message, "25%") {
+		t.Fatalf("test cases = %+v, want error_rate to fail with its actual value", suite.TestCases)
+	}
+}
+
+func TestReportOutMarkdownAndHTML(t *testing.T) {
+	e := newTestExport(t)
+	md := writeTestReport(t, e, "markdown")
+	for _, want := range []string{"# Benchmarking <test>\n", "| 429 | 1 |\n", "| error_rate<1% | 25% | FAIL |\n"} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("markdown report misses %q:\n%s", want, md)
+		}
+	}
+	page := writeTestReport(t, e, "html")
+	for _, want := range []string{"<h1>Benchmarking &lt;test&gt;</h1>", "<td>dial tcp: &lt;refused&gt;, again</td>"} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("html report misses %q:\n%s", want, page)
+		}
+	}
+
+	if err := WriteReportFile(filepath.Join(t.TempDir(), "report"), "xlsx", e); err == nil {
+		t.Fatal("WriteReportFile accepted an unknown format")
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	url2 "net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpcinsecure "google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcCodeOffset is added to gRPC status codes before they're stored in
+// ReportRecord.code, so they can share StreamReport.codes with HTTP codes.
+const grpcCodeOffset = 1000
+
+func grpcCodeName(code int) string {
+	return "grpc " + codes.Code(code-grpcCodeOffset).String()
+}
+
+// grpcClient calls one unary or server-streaming method with a request
+// decoded from JSON, each worker uses its own connection.
+type grpcClient struct {
+	method    string
+	desc      protoreflect.MethodDescriptor
+	request   proto.Message
+	conns     []*grpc.ClientConn
+	md        metadata.MD
+	timeout   time.Duration
+	errWriter io.Writer
+}
+
+func parseGRPCMethod(name string) (service, method string, err error) {
+	name = strings.TrimPrefix(name, "/")
+	i := strings.LastIndexAny(name, "/.")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("invalid gRPC method %q, example: package.Service/Method", name)
+	}
+	return name[:i], name[i+1:], nil
+}
+
+func newGRPCClient(opt *ClientOpt, concurrency int, r, w *int64, errWriter io.Writer) (*grpcClient, error) {
+	u, err := url2.Parse(opt.url)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("gRPC requires an http or https url")
+	}
+	serviceName, methodName, err := parseGRPCMethod(opt.grpcMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	dial, err := buildDialFunc(opt)
+	if err != nil {
+		return nil, err
+	}
+	dial = ThroughputInterceptorDial(dial, r, w)
+	dialOpts := []grpc.DialOption{
+		grpc.WithContextDialer(func(_ context.Context, addr string) (net.Conn, error) {
+			return dial(addr)
+		}),
+		grpc.WithUserAgent("plow"),
+	}
+	if u.Scheme == "https" {
+		tlsConfig, err := buildTLSConfig(opt)
+		if err != nil {
+			return nil, err
+		}
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(grpcinsecure.NewCredentials()))
+	}
+	if opt.host != "" {
+		dialOpts = append(dialOpts, grpc.WithAuthority(opt.host))
+	}
+
+	c := &grpcClient{
+		method:    "/" + serviceName + "/" + methodName,
+		md:        metadata.MD{},
+		timeout:   opt.doTimeout,
+		errWriter: errWriter,
+	}
+	for _, h := range opt.headers {
+		n := strings.SplitN(h, ":", 2)
+		if len(n) != 2 {
+			return nil, fmt.Errorf("invalid header: %s", h)
+		}
+		c.md.Append(strings.TrimSpace(n[0]), strings.TrimSpace(n[1]))
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	target := "passthrough:///" + addMissingPort(u.Host, u.Scheme == "https")
+	for i := 0; i < concurrency; i++ {
+		conn, err := grpc.NewClient(target, dialOpts...)
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+		c.conns = append(c.conns, conn)
+	}
+
+	files, err := loadGRPCFiles(opt, c.conns[0], serviceName)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("gRPC service %s: %v", serviceName, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		c.close()
+		return nil, fmt.Errorf("%s is not a gRPC service", serviceName)
+	}
+	c.desc = sd.Methods().ByName(protoreflect.Name(methodName))
+	if c.desc == nil {
+		c.close()
+		return nil, fmt.Errorf("gRPC service %s has no method %s", serviceName, methodName)
+	}
+	if c.desc.IsStreamingClient() {
+		c.close()
+		return nil, fmt.Errorf("gRPC method %s is client streaming, only unary and server streaming methods are supported", c.method)
+	}
+
+	body := opt.bodyBytes
+	if opt.bodyFile != "" {
+		body, err = os.ReadFile(opt.bodyFile)
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	request := dynamicpb.NewMessage(c.desc.Input())
+	if len(body) > 0 {
+		resolver := dynamicpb.NewTypes(files)
+		if err := (protojson.UnmarshalOptions{Resolver: resolver}).Unmarshal(body, request); err != nil {
+			c.close()
+			return nil, fmt.Errorf("invalid gRPC request body: %v", err)
+		}
+	}
+	c.request = request
+	return c, nil
+}
+
+func (c *grpcClient) close() {
+	for _, conn := range c.conns {
+		_ = conn.Close()
+	}
+}
+
+// loadGRPCFiles returns the descriptors from --grpc-protoset, or asks the
+// server for them through the reflection service.
+func loadGRPCFiles(opt *ClientOpt, conn *grpc.ClientConn, symbol string) (*protoregistry.Files, error) {
+	var fds []*descriptorpb.FileDescriptorProto
+	if opt.grpcProtoset != "" {
+		data, err := os.ReadFile(opt.grpcProtoset)
+		if err != nil {
+			return nil, err
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("invalid protoset %s: %v", opt.grpcProtoset, err)
+		}
+		fds = set.File
+	} else {
+		timeout := opt.dialTimeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		files, err := reflectFiles(ctx, conn, symbol)
+		if status.Code(err) == codes.Unimplemented {
+			files, err = reflectFilesV1Alpha(ctx, conn, symbol)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gRPC reflection failed, use --grpc-protoset instead: %v", err)
+		}
+		for _, b := range files {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return nil, err
+			}
+			fds = append(fds, fd)
+		}
+	}
+
+	// well-known types may be left out as every client is expected to have them
+	seen := make(map[string]bool, len(fds))
+	for _, fd := range fds {
+		seen[fd.GetName()] = true
+	}
+	for i := 0; i < len(fds); i++ {
+		for _, dep := range fds[i].GetDependency() {
+			if seen[dep] {
+				continue
+			}
+			if d, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				fds = append(fds, protodesc.ToFileDescriptorProto(d))
+				seen[dep] = true
+			}
+		}
+	}
+	return protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: fds})
+}
+
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, symbol string) ([][]byte, error) {
+	stream, err := reflectionv1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stream.CloseSend() }()
+	err = stream.Send(&reflectionv1.ServerReflectionRequest{
+		MessageRequest: &reflectionv1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+	}
+	return resp.GetFileDescriptorResponse().GetFileDescriptorProto(), nil
+}
+
+func reflectFilesV1Alpha(ctx context.Context, conn *grpc.ClientConn, symbol string) ([][]byte, error) {
+	stream, err := reflectionv1alpha.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stream.CloseSend() }()
+	err = stream.Send(&reflectionv1alpha.ServerReflectionRequest{
+		MessageRequest: &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+	}
+	return resp.GetFileDescriptorResponse().GetFileDescriptorProto(), nil
+}
+
+func (c *grpcClient) call(conn *grpc.ClientConn) error {
+	ctx := metadata.NewOutgoingContext(context.Background(), c.md)
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	if !c.desc.IsStreamingServer() {
+		return conn.Invoke(ctx, c.method, c.request, dynamicpb.NewMessage(c.desc.Output()))
+	}
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, c.method)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(c.request); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	resp := dynamicpb.NewMessage(c.desc.Output())
+	for {
+		if err := stream.RecvMsg(resp); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Do runs one call, a server-streaming call lasts until the last message
+// is received. gRPC statuses are recorded as codes, other failures as errors.
+func (c *grpcClient) Do(conn *grpc.ClientConn, rr *ReportRecord) {
+	startTime := time.Now()
+	err := c.call(conn)
+	rr.cost = time.Since(startTime)
+	rr.error = ""
+	st, ok := status.FromError(err)
+	if !ok {
+		rr.code = 0
+		rr.error = err.Error()
+		return
+	}
+	rr.code = grpcCodeOffset + int(st.Code())
+	if st.Code() != codes.OK {
+		_, _ = c.errWriter.Write([]byte(fmt.Sprintf("\n%s %s\n%s\n", grpcCodeName(rr.code), rr.cost, st.Message())))
+	}
+}
+
+func (r *Requester) runGRPCWorker(ctx context.Context, cancel func(), limiter *rate.Limiter, semaphore *int64, id int) {
+	conn := r.grpc.conns[(id-1)%len(r.grpc.conns)]
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if !r.acquire(ctx, cancel, limiter, semaphore) {
+			continue
+		}
+		rr := recordPool.Get().(*ReportRecord)
+		r.grpc.Do(conn, rr)
+		r.sendRecord(rr, "", id)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type testHealthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (testHealthServer) Check(_ context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.Service != "" && req.Service != "plow" {
+		return nil, status.Errorf(codes.NotFound, "unknown service %s", req.Service)
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (testHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	for i := 0; i < 3; i++ {
+		if err := stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startGRPCServer(t *testing.T, withReflection bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, testHealthServer{})
+	if withReflection {
+		reflection.Register(server)
+	}
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(server.Stop)
+	return "http://" + ln.Addr().String()
+}
+
+// lockedBuffer is an --output-errors file the workers can write at once.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func runGRPCRequester(t *testing.T, opt *ClientOpt, requests int64) (map[int]int, *lockedBuffer) {
+	t.Helper()
+	opt.dialTimeout = time.Second
+	opt.doTimeout = time.Second
+	var errOut lockedBuffer
+	requester, err := NewRequester(2, requests, 0, nil, &errOut, opt, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := map[int]int{}
+	for _, record := range collectRecords(t, requester) {
+		if record.error != "" {
+			t.Fatalf("record error = %q, want none", record.error)
+		}
+		codes[record.code]++
+	}
+	// Run has closed the connections, nothing counts the bytes anymore
+	if atomic.LoadInt64(&requester.readBytes) == 0 || atomic.LoadInt64(&requester.writeBytes) == 0 {
+		t.Fatal("read/write bytes were not counted")
+	}
+	for _, conn := range requester.grpc.conns {
+		if state := conn.GetState(); state != connectivity.Shutdown {
+			t.Fatalf("connection state = %s after the run, want it closed", state)
+		}
+	}
+	return codes, &errOut
+}
+
+func TestGRPCUnaryWithReflection(t *testing.T) {
+	url := startGRPCServer(t, true)
+	got, _ := runGRPCRequester(t, &ClientOpt{
+		url:        url,
+		grpcMethod: "grpc.health.v1.Health/Check",
+		bodyBytes:  []byte(`{"service": "plow"}`),
+	}, 10)
+	if got[grpcCodeOffset+int(codes.OK)] != 10 {
+		t.Fatalf("codes = %v, want 10 OK", got)
+	}
+
+	got, errOut := runGRPCRequester(t, &ClientOpt{
+		url:        url,
+		grpcMethod: "grpc.health.v1.Health.Check",
+		bodyBytes:  []byte(`{"service": "other"}`),
+	}, 4)
+	if got[grpcCodeOffset+int(codes.NotFound)] != 4 {
+		t.Fatalf("codes = %v, want 4 NotFound", got)
+	}
+	if !strings.Contains(errOut.String(), "grpc NotFound") || !strings.Contains(errOut.String(), "unknown service other") {
+		t.Fatalf("error output = %q, want the status and its message", errOut.String())
+	}
+}
+
+func TestGRPCServerStreamingWithProtoset(t *testing.T) {
+	url := startGRPCServer(t, false)
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+	}}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoset := filepath.Join(t.TempDir(), "health.protoset")
+	if err := os.WriteFile(protoset, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := runGRPCRequester(t, &ClientOpt{
+		url:          url,
+		grpcMethod:   "/grpc.health.v1.Health/Watch",
+		grpcProtoset: protoset,
+	}, 6)
+	if got[grpcCodeOffset+int(codes.OK)] != 6 {
+		t.Fatalf("codes = %v, want 6 OK", got)
+	}
+}
+
+func TestGRPCRejectsInvalidInput(t *testing.T) {
+	url := startGRPCServer(t, true)
+	tests := []struct {
+		name string
+		opt  *ClientOpt
+	}{
+		{"method", &ClientOpt{url: url, grpcMethod: "Check"}},
+		{"unknown method", &ClientOpt{url: url, grpcMethod: "grpc.health.v1.Health/Nope"}},
+		{"body", &ClientOpt{url: url, grpcMethod: "grpc.health.v1.Health/Check", bodyBytes: []byte(`{"nope": 1}`)}},
+		{"no reflection", &ClientOpt{url: startGRPCServer(t, false), grpcMethod: "grpc.health.v1.Health/Check"}},
+		{"protoset without method", &ClientOpt{url: url, grpcProtoset: "health.protoset"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opt.dialTimeout = time.Second
+			if _, err := NewRequester(1, 1, 0, nil, io.Discard, tt.opt, -1); err == nil {
+				t.Fatal("NewRequester succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestCodeSectionsNamesGRPCCodes(t *testing.T) {
+	got := codeSections(map[int]int64{200: 1, 204: 2, grpcCodeOffset: 3, grpcCodeOffset + int(codes.Unavailable): 4})
+	want := map[string]int64{"2xx": 3, "grpc OK": 3, "grpc Unavailable": 4}
+	if len(got) != len(want) {
+		t.Fatalf("codeSections() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("codeSections() = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	url2 "net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
+)
+
+// HTTPClient is the part of fasthttp.HostClient the requester relies on, so
+// other protocols can be plugged in behind the same ReportRecord pipeline.
+type HTTPClient interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+	DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error
+}
+
+// roundTripClient adapts a net/http RoundTripper to HTTPClient by converting
+// requests and responses on the way through.
+type roundTripClient struct {
+	rt     http.RoundTripper
+	scheme string
+}
+
+func (c *roundTripClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return c.DoTimeout(req, resp, 0)
+}
+
+func (c *roundTripClient) DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := c.do(ctx, req, resp)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fasthttp.ErrTimeout
+	}
+	return err
+}
+
+func (c *roundTripClient) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	hreq, err := c.newRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+	hresp, err := c.rt.RoundTrip(hreq)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+
+	resp.Reset()
+	resp.SetStatusCode(hresp.StatusCode)
+	for k, vs := range hresp.Header {
+		for _, v := range vs {
+			resp.Header.Add(k, v)
+		}
+	}
+	_, err = io.Copy(resp.BodyWriter(), hresp.Body)
+	return err
+}
+
+func (c *roundTripClient) newRequest(ctx context.Context, req *fasthttp.Request) (*http.Request, error) {
+	var body io.Reader
+	contentLength := int64(-1)
+	if req.IsBodyStream() {
+		body = req.BodyStream()
+	} else if b := req.Body(); len(b) > 0 {
+		body = bytes.NewReader(b)
+		contentLength = int64(len(b))
+	}
+
+	host := string(req.Header.Host())
+	hreq, err := http.NewRequestWithContext(ctx, string(req.Header.Method()), c.scheme+"://"+host+string(req.URI().RequestURI()), body)
+	if err != nil {
+		return nil, err
+	}
+	hreq.Host = host
+	if body != nil {
+		hreq.ContentLength = contentLength
+	} else {
+		hreq.ContentLength = 0
+	}
+	for k, v := range req.Header.All() {
+		switch string(k) {
+		case fasthttp.HeaderHost, fasthttp.HeaderContentLength, fasthttp.HeaderConnection, fasthttp.HeaderTransferEncoding:
+			continue
+		}
+		hreq.Header.Add(string(k), string(v))
+	}
+	if hreq.Header.Get(fasthttp.HeaderUserAgent) == "" {
+		hreq.Header.Set(fasthttp.HeaderUserAgent, "plow")
+	}
+	return hreq, nil
+}
+
+type h2Conn struct {
+	mu      sync.Mutex
+	cc      *http2.ClientConn
+	streams chan struct{}
+}
+
+// h2Pool multiplexes requests over a fixed number of HTTP/2 connections,
+// allowing at most maxStreams in-flight streams on each of them.
+type h2Pool struct {
+	transport *http2.Transport
+	dial      func() (net.Conn, error)
+	conns     []*h2Conn
+	next      uint32
+}
+
+type h2Body struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *h2Body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func (p *h2Pool) acquire(ctx context.Context) (*h2Conn, error) {
+	n := atomic.AddUint32(&p.next, 1)
+	for i := range p.conns {
+		c := p.conns[(int(n)+i)%len(p.conns)]
+		select {
+		case c.streams <- struct{}{}:
+			return c, nil
+		default:
+		}
+	}
+	c := p.conns[int(n)%len(p.conns)]
+	select {
+	case c.streams <- struct{}{}:
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *h2Pool) clientConn(c *h2Conn) (*http2.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cc != nil && c.cc.CanTakeNewRequest() {
+		return c.cc, nil
+	}
+	// a connection that got GOAWAY or failed closes itself once its
+	// remaining streams finish, so it's just replaced here
+	c.cc = nil
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	cc, err := p.transport.NewClientConn(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	c.cc = cc
+	return cc, nil
+}
+
+func (p *h2Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, err := p.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	release := func() { <-c.streams }
+	cc, err := p.clientConn(c)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &h2Body{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// NewH2Client returns an HTTP/2 client for the target of opt, negotiated via
+// TLS ALPN for https and with prior knowledge (h2c) for plain http.
+func NewH2Client(opt *ClientOpt, r, w *int64) (HTTPClient, error) {
+	u, err := url2.Parse(opt.url)
+	if err != nil {
+		return nil, err
+	}
+	if opt.h2Conns <= 0 || opt.h2MaxStreams <= 0 {
+		return nil, fmt.Errorf("invalid HTTP/2 connections %d or max streams %d", opt.h2Conns, opt.h2MaxStreams)
+	}
+	isTLS := u.Scheme == "https"
+	addr := addMissingPort(u.Host, isTLS)
+	dial, err := buildDialFunc(opt)
+	if err != nil {
+		return nil, err
+	}
+	dial = ThroughputInterceptorDial(dial, r, w)
+	tlsConfig, err := buildTLSConfig(opt)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	pool := &h2Pool{
+		transport: &http2.Transport{
+			AllowHTTP:          !isTLS,
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: true,
+		},
+		conns: make([]*h2Conn, opt.h2Conns),
+	}
+	for i := range pool.conns {
+		pool.conns[i] = &h2Conn{streams: make(chan struct{}, opt.h2MaxStreams)}
+	}
+	pool.dial = func() (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil || !isTLS {
+			return conn, err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		ctx := context.Background()
+		if opt.dialTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opt.dialTimeout)
+			defer cancel()
+		}
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		if p := tlsConn.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+			_ = conn.Close()
+			return nil, fmt.Errorf("server %s does not support HTTP/2 (ALPN %q)", addr, p)
+		}
+		return tlsConn, nil
+	}
+
+	scheme := "http"
+	if isTLS {
+		scheme = "https"
+	}
+	return &roundTripClient{rt: pool, scheme: scheme}, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type h2TestHandler struct {
+	mu          sync.Mutex
+	inflight    int
+	maxInflight int
+	remotes     map[string]bool
+	paths       []string
+	protoMajor  int32
+	bodies      int32
+}
+
+func (h *h2TestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.inflight++
+	if h.inflight > h.maxInflight {
+		h.maxInflight = h.inflight
+	}
+	if h.remotes == nil {
+		h.remotes = map[string]bool{}
+	}
+	h.remotes[r.RemoteAddr] = true
+	h.paths = append(h.paths, r.URL.RequestURI())
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.inflight--
+		h.mu.Unlock()
+	}()
+
+	atomic.StoreInt32(&h.protoMajor, int32(r.ProtoMajor))
+	if b, _ := io.ReadAll(r.Body); string(b) == "ping" {
+		atomic.AddInt32(&h.bodies, 1)
+	}
+	time.Sleep(10 * time.Millisecond)
+	w.Header().Set("X-Proto", r.Proto)
+	_, _ = io.WriteString(w, "pong")
+}
+
+func runH2Requester(t *testing.T, opt *ClientOpt, concurrency int, requests int64) *Requester {
+	t.Helper()
+	opt.method = fasthttp.MethodPost
+	opt.bodyBytes = []byte("ping")
+	opt.h2 = true
+	opt.dialTimeout = time.Second
+	opt.doTimeout = 5 * time.Second
+	requester, err := NewRequester(concurrency, requests, 0, nil, io.Discard, opt, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := collectRecords(t, requester)
+	for _, record := range records {
+		if record.code != http.StatusOK || record.error != "" {
+			t.Fatalf("record = code %d error %q, want 200", record.code, record.error)
+		}
+	}
+	if int64(len(records)) != requests {
+		t.Fatalf("got %d records, want %d", len(records), requests)
+	}
+	if atomic.LoadInt64(&requester.readBytes) == 0 || atomic.LoadInt64(&requester.writeBytes) == 0 {
+		t.Fatal("read/write bytes were not counted")
+	}
+	return requester
+}
+
+func TestH2ClientPriorKnowledge(t *testing.T) {
+	handler := &h2TestHandler{}
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: handler, Protocols: &http.Protocols{}}
+	server.Protocols.SetUnencryptedHTTP2(true)
+	go func() { _ = server.Serve(ln) }()
+	defer server.Close()
+
+	runH2Requester(t, &ClientOpt{
+		url:          "http://" + ln.Addr().String() + "/",
+		h2Conns:      1,
+		h2MaxStreams: 2,
+	}, 8, 24)
+
+	if got := atomic.LoadInt32(&handler.protoMajor); got != 2 {
+		t.Fatalf("server saw HTTP/%d, want HTTP/2", got)
+	}
+	if got := atomic.LoadInt32(&handler.bodies); got != 24 {
+		t.Fatalf("server got %d request bodies, want 24", got)
+	}
+	if len(handler.remotes) != 1 {
+		t.Fatalf("server saw %d connections, want 1", len(handler.remotes))
+	}
+	if handler.maxInflight > 2 {
+		t.Fatalf("server saw %d concurrent streams, want at most 2", handler.maxInflight)
+	}
+}
+
+func TestH2ClientEvaluatesTheURLTemplates(t *testing.T) {
+	handler := &h2TestHandler{}
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	runH2Requester(t, &ClientOpt{
+		url:          server.URL + "/users/{{seq}}?n={{seq}}",
+		insecure:     true,
+		h2Conns:      1,
+		h2MaxStreams: 1,
+	}, 1, 3)
+
+	if got := strings.Join(handler.paths, ","); got != "/users/1?n=1,/users/2?n=2,/users/3?n=3" {
+		t.Fatalf("server got %s, want the evaluated urls", got)
+	}
+}
+
+func TestH2ClientTLS(t *testing.T) {
+	handler := &h2TestHandler{}
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	runH2Requester(t, &ClientOpt{
+		url:          server.URL + "/",
+		insecure:     true,
+		h2Conns:      2,
+		h2MaxStreams: 10,
+	}, 4, 20)
+
+	if got := atomic.LoadInt32(&handler.protoMajor); got != 2 {
+		t.Fatalf("server saw HTTP/%d, want HTTP/2", got)
+	}
+	if len(handler.remotes) != 2 {
+		t.Fatalf("server saw %d connections, want 2", len(handler.remotes))
+	}
+}
+
+func TestH2ClientRejectsServerWithoutH2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := NewH2Client(&ClientOpt{url: server.URL, insecure: true, h2Conns: 1, h2MaxStreams: 1}, new(int64), new(int64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &fasthttp.Request{}
+	req.SetRequestURI(server.URL)
+	req.Header.SetHost(server.Listener.Addr().String())
+	if err := client.Do(req, &fasthttp.Response{}); err == nil {
+		t.Fatal("Do succeeded against an HTTP/1.1-only server, want error")
+	}
+}
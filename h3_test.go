@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/valyala/fasthttp"
+)
+
+func testTLSCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "plow test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestH3Client(t *testing.T) {
+	var protoMajor, bodies int32
+	server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{testTLSCertificate(t)}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.StoreInt32(&protoMajor, int32(r.ProtoMajor))
+			if b, _ := io.ReadAll(r.Body); string(b) == "ping" {
+				atomic.AddInt32(&bodies, 1)
+			}
+			_, _ = io.WriteString(w, "pong")
+		}),
+	}
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(conn) }()
+	defer func() {
+		_ = server.Close()
+		_ = conn.Close()
+	}()
+
+	requester, err := NewRequester(4, 20, 0, nil, io.Discard, &ClientOpt{
+		url:         "https://" + conn.LocalAddr().String() + "/",
+		method:      fasthttp.MethodPost,
+		bodyBytes:   []byte("ping"),
+		insecure:    true,
+		h3:          true,
+		dialTimeout: time.Second,
+		doTimeout:   5 * time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := collectRecords(t, requester)
+	for _, record := range records {
+		if record.code != http.StatusOK || record.error != "" {
+			t.Fatalf("record = code %d error %q, want 200", record.code, record.error)
+		}
+	}
+	if len(records) != 20 {
+		t.Fatalf("got %d records, want 20", len(records))
+	}
+	if got := atomic.LoadInt32(&protoMajor); got != 3 {
+		t.Fatalf("server saw HTTP/%d, want HTTP/3", got)
+	}
+	if got := atomic.LoadInt32(&bodies); got != 20 {
+		t.Fatalf("server got %d request bodies, want 20", got)
+	}
+	if atomic.LoadInt64(&requester.readBytes) == 0 || atomic.LoadInt64(&requester.writeBytes) == 0 {
+		t.Fatal("read/write bytes were not counted")
+	}
+}
+
+func TestNewH3ClientRejectsPlainHTTP(t *testing.T) {
+	if _, err := NewH3Client(&ClientOpt{url: "http://127.0.0.1:8080/"}, new(int64), new(int64)); err == nil {
+		t.Fatal("NewH3Client succeeded for an http url, want error")
+	}
+	if _, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: "https://127.0.0.1/", h2: true, h3: true, h2Conns: 1, h2MaxStreams: 1}, -1); err == nil {
+		t.Fatal("NewRequester succeeded with --h2 and --h3, want error")
+	}
+}
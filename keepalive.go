@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// errConnRetired is returned by the write of a request on a connection that
+// served --max-requests-per-conn, the client retries it on another one.
+var errConnRetired = errors.New("connection reached --max-requests-per-conn")
+
+type connCounts struct {
+	opened int64
+	closed int64
+	reused int64
+	failed int64
+}
+
+// connStats counts the connections of the HTTP/1.1 clients.
+type connStats struct {
+	connCounts
+	maxRequests int
+}
+
+func (cs *connStats) load() connCounts {
+	return connCounts{
+		opened: atomic.LoadInt64(&cs.opened),
+		closed: atomic.LoadInt64(&cs.closed),
+		reused: atomic.LoadInt64(&cs.reused),
+		failed: atomic.LoadInt64(&cs.failed),
+	}
+}
+
+// track counts the outcome of a dial and wraps the connection.
+func (cs *connStats) track(conn net.Conn, err error) (net.Conn, error) {
+	if err != nil {
+		atomic.AddInt64(&cs.failed, 1)
+		return nil, err
+	}
+	atomic.AddInt64(&cs.opened, 1)
+	return &countedConn{Conn: conn, stats: cs}, nil
+}
+
+// keepAliveSet tells whether opt changes how the connections are kept
+// alive, they are only counted then.
+func keepAliveSet(opt *ClientOpt) bool {
+	return opt.disableKeepAlive || opt.maxRequestsPerConn > 0 || opt.connMaxLifetime > 0
+}
+
+// handshakeTimeout bounds the TLS handshakes of connStats.wrap, fasthttp
+// gives them the time of the request.
+func handshakeTimeout(opt *ClientOpt) time.Duration {
+	if opt.doTimeout > 0 {
+		return opt.doTimeout
+	}
+	if opt.writeTimeout > 0 {
+		return opt.writeTimeout
+	}
+	return opt.dialTimeout
+}
+
+// wrap counts the connections of dial. With isTLS the handshake is done here
+// so that the requests are counted above it.
+func (cs *connStats) wrap(dial fasthttp.DialFunc, isTLS bool, tlsConf *tls.Config, timeout time.Duration) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err == nil && isTLS {
+			conn, err = tlsHandshake(conn, tlsConf, addr, timeout)
+		}
+		return cs.track(conn, err)
+	}
+}
+
+// retryIfErr retries the requests refused by a retired connection, and the
+// idempotent ones like fasthttp does by default.
+func retryIfErr(req *fasthttp.Request, attempts int, err error) (bool, bool) {
+	if errors.Is(err, errConnRetired) {
+		return false, true
+	}
+	idempotent := req.Header.IsGet() || req.Header.IsHead() || req.Header.IsPut()
+	return false, idempotent && attempts < fasthttp.DefaultMaxIdemponentCallAttempts
+}
+
+// countedConn tells the requests apart by the write that follows a read.
+type countedConn struct {
+	net.Conn
+	stats    *connStats
+	requests int
+	writing  bool
+	closed   int32
+}
+
+// Handshake keeps fasthttp from starting TLS over the connection, it is
+// either plain or done by connStats.wrap.
+func (c *countedConn) Handshake() error {
+	return nil
+}
+
+func (c *countedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.writing = false
+	}
+	return n, err
+}
+
+func (c *countedConn) Write(b []byte) (int, error) {
+	if !c.writing {
+		if c.stats.maxRequests > 0 && c.requests >= c.stats.maxRequests {
+			_ = c.Close()
+			return 0, errConnRetired
+		}
+		if c.requests > 0 {
+			atomic.AddInt64(&c.stats.reused, 1)
+		}
+		c.requests++
+		c.writing = true
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *countedConn) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return nil
+	}
+	atomic.AddInt64(&c.stats.closed, 1)
+	return c.Conn.Close()
+}
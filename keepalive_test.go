@@ -0,0 +1,201 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// runConnCounts runs opt and returns the connection counts of its last record.
+func runConnCounts(t *testing.T, requests int64, opt *ClientOpt) connCounts {
+	t.Helper()
+	requester, err := NewRequester(1, requests, 0, nil, io.Discard, opt, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last connCounts
+	for _, rr := range collectRecords(t, requester) {
+		if rr.code != fasthttp.StatusOK {
+			t.Fatalf("record = code %d error %q, want 200", rr.code, rr.error)
+		}
+		last = rr.conns
+	}
+	return last
+}
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	var mu sync.Mutex
+	conns := map[uint64]int{}
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		conns[ctx.ConnID()]++
+		mu.Unlock()
+	})
+
+	counts := runConnCounts(t, 7, &ClientOpt{
+		url:                "http://" + addr + "/",
+		method:             fasthttp.MethodPost,
+		bodyBytes:          []byte("x"),
+		maxRequestsPerConn: 3,
+		maxConns:           1,
+		dialTimeout:        time.Second,
+		doTimeout:          time.Second,
+	})
+	if counts.opened != 3 || counts.reused != 4 || counts.failed != 0 {
+		t.Fatalf("counts = %+v, want 3 opened and 4 reused", counts)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(conns) != 3 {
+		t.Fatalf("the server saw %d connections, want 3", len(conns))
+	}
+	for id, n := range conns {
+		if n > 3 {
+			t.Fatalf("connection %d served %d requests, want at most 3", id, n)
+		}
+	}
+}
+
+func TestConnCountsOverTLS(t *testing.T) {
+	var mu sync.Mutex
+	var opened, closing int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Close {
+			mu.Lock()
+			closing++
+			mu.Unlock()
+		}
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			opened++
+			mu.Unlock()
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	counts := runConnCounts(t, 4, &ClientOpt{
+		url:                server.URL,
+		method:             fasthttp.MethodGet,
+		insecure:           true,
+		maxRequestsPerConn: 2,
+		maxConns:           1,
+		dialTimeout:        time.Second,
+		doTimeout:          time.Second,
+	})
+	if counts.opened != 2 || counts.reused != 2 {
+		t.Fatalf("counts = %+v, want 2 opened and 2 reused, the handshake isn't a request", counts)
+	}
+
+	counts = runConnCounts(t, 3, &ClientOpt{
+		url:              server.URL,
+		method:           fasthttp.MethodGet,
+		insecure:         true,
+		disableKeepAlive: true,
+		maxConns:         1,
+		dialTimeout:      time.Second,
+		doTimeout:        time.Second,
+	})
+	if counts.opened != 3 || counts.closed != 3 || counts.reused != 0 {
+		t.Fatalf("counts = %+v, want every request on its own connection", counts)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if opened != 5 || closing != 3 {
+		t.Fatalf("the server saw %d connections and %d Connection: close, want 5 and 3", opened, closing)
+	}
+}
+
+func TestConnCountsFailedDials(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	requester, err := NewRequester(1, 2, 0, nil, io.Discard, &ClientOpt{
+		url:             "http://" + addr + "/",
+		method:          fasthttp.MethodGet,
+		maxConns:        1,
+		connMaxLifetime: time.Minute,
+		dialTimeout:     time.Second,
+		doTimeout:       time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last connCounts
+	for _, rr := range collectRecords(t, requester) {
+		last = rr.conns
+	}
+	if last.failed == 0 || last.opened != 0 {
+		t.Fatalf("counts = %+v, want failed dials only", last)
+	}
+
+	if _, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: "http://" + addr + "/", disableKeepAlive: true, h2: true}, -1); err == nil {
+		t.Fatal("NewRequester accepted --disable-keepalive with --h2")
+	}
+}
+
+func TestStreamReportConnections(t *testing.T) {
+	records := make(chan *ReportRecord, 2)
+	records <- &ReportRecord{cost: time.Millisecond, code: 200, conns: connCounts{opened: 1}}
+	records <- &ReportRecord{cost: time.Millisecond, code: 200, conns: connCounts{opened: 2, closed: 1, reused: 3, failed: 1}}
+	close(records)
+
+	report := NewStreamReport()
+	report.Collect(records)
+	c := report.Snapshot().Connections
+	if c == nil || c.Opened != 2 || c.Closed != 1 || c.Reused != 3 || c.Failed != 1 {
+		t.Fatalf("connections = %+v, want the counts of the last record", c)
+	}
+	if NewStreamReport().Snapshot().Connections != nil {
+		t.Fatal("a report without connections has connection counts")
+	}
+}
+
+func TestConnsAreOnlyWrappedWithKeepAliveOptions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	opt := &ClientOpt{url: server.URL, method: fasthttp.MethodGet, maxConns: 1, insecure: true, dialTimeout: time.Second, doTimeout: time.Second}
+	if c := runConnCounts(t, 3, opt); c != (connCounts{}) {
+		t.Fatalf("counts = %+v without a keep-alive option, want none", c)
+	}
+	timed := *opt
+	timed.timings = true
+	if c := runConnCounts(t, 3, &timed); c != (connCounts{}) {
+		t.Fatalf("counts = %+v with --timings only, want none", c)
+	}
+
+	// a server that never answers the handshake
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, _, err := buildRequestClient(&ClientOpt{
+		url:                "https://" + ln.Addr().String() + "/",
+		method:             fasthttp.MethodGet,
+		maxRequestsPerConn: 1,
+		doTimeout:          100 * time.Millisecond,
+	}, new(int64), new(int64), &connStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := client.Dial(ln.Addr().String()); err == nil {
+		t.Fatal("the handshake succeeded, want a timeout")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("the handshake gave up after %s, want the --timeout", d)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -19,7 +21,11 @@ import (
 var (
 	concurrency = kingpin.Flag("concurrency", "Number of connections to run concurrently").Short('c').Default("1").Int()
 	reqRate     = rateFlag(kingpin.Flag("rate", "Number of requests per time unit, examples: --rate 50 --rate 10/ms").Default("infinity"))
+	openModel   = kingpin.Flag("open-model", "Send requests at --rate on a fixed schedule however slow the server is, latency is measured from the scheduled time").Bool()
+	maxInflight = kingpin.Flag("max-inflight", "Maximum requests in flight with --open-model, scheduled requests beyond it are dropped").Default("1000").Int()
 	rampUp      = kingpin.Flag("ramp-up", "Concurrently will increase pre seconds").Default("-1").Int()
+	stages      = kingpin.Flag("stages", "Concurrency profile as DURATION:TARGET stages, each moving linearly from the previous target, overrides -c, example: --stages 30s:10,1m:100,30s:100,30s:0").PlaceHolder("STAGES").String()
+	rateStages  = kingpin.Flag("rate-stages", "Rate profile in requests per second as DURATION:TARGET stages, example: --rate-stages 10s:100,0s:500,10s:500,10s:0").PlaceHolder("STAGES").String()
 	requests    = kingpin.Flag("requests", "Number of requests to run").Short('n').Default("-1").Int64()
 	duration    = kingpin.Flag("duration", "Duration of test, examples: -d 10s -d 3m").Short('d').PlaceHolder("DURATION").Duration()
 	interval    = kingpin.Flag("interval", "Print snapshot result every interval, use 0 to print once at the end").Short('i').Default("200ms").Duration()
@@ -39,21 +45,74 @@ var (
 	cert        = kingpin.Flag("cert", "Path to the client's TLS Certificate").ExistingFile()
 	key         = kingpin.Flag("key", "Path to the client's TLS Certificate Private Key").ExistingFile()
 	insecure    = kingpin.Flag("insecure", "Controls whether a client verifies the server's certificate chain and host name").Short('k').Bool()
-
-	chartsListenAddr = kingpin.Flag("listen", "Listen addr to serve Web UI").Default(":18888").String()
+	cookies     = kingpin.Flag("cookies", "Give every worker its own cookie jar, the cookies set by the responses are sent with its next requests").Bool()
+	cookieFile  = kingpin.Flag("cookie-file", "Netscape cookie file (curl -c) loaded into every cookie jar, implies --cookies").PlaceHolder("FILE").ExistingFile()
+
+	timings         = kingpin.Flag("timings", "Report the DNS, connect, TLS, time to first byte and transfer phases of the requests, every worker then keeps its own connection").Bool()
+	followRedirects = kingpin.Flag("follow-redirects", "Follow up to N redirects of the Location header, the latency covers every hop and the summary counts the redirects apart from the final status").Default("0").PlaceHolder("N").Int()
+
+	disableKeepAlive   = kingpin.Flag("disable-keepalive", "Close the connection after every request, each request then opens a new one").Bool()
+	maxRequestsPerConn = kingpin.Flag("max-requests-per-conn", "Close the connections after N requests each").Default("0").PlaceHolder("N").Int()
+	connMaxLifetime    = kingpin.Flag("conn-max-lifetime", "Close the connections once they are older than DURATION, after their current request").PlaceHolder("DURATION").Duration()
+
+	targetsFile  = kingpin.Flag("targets", "File of urls to spread the requests across along with the url arguments, one \"URL [WEIGHT]\" per line").PlaceHolder("FILE").ExistingFile()
+	targetsMode  = kingpin.Flag("targets-mode", "How requests pick the target among several urls: round-robin, random, weighted or least-inflight").Default("round-robin").Enum(targetsModes...)
+	requestsFile = kingpin.Flag("requests-file", "JSON Lines file of requests to send, one {method, url, headers, body, body_file, weight, label} object per line, urls are resolved against <url>").PlaceHolder("FILE").ExistingFile()
+	requestsMode = kingpin.Flag("requests-mode", "How workers pick the next request from --requests-file: round-robin, random or weighted").Default("round-robin").Enum(requestsModes...)
+	scenarioFile = kingpin.Flag("scenario", "JSON Lines file of the steps every worker runs in order, a --requests-file object plus \"extract\": [{var, json_path|header|regex}], later steps read the values with {{var \"NAME\"}}, -n and --rate count journeys").PlaceHolder("FILE").ExistingFile()
+	scriptFile   = kingpin.Flag("script", "JavaScript file defining request(vu, iter, data) to build each request and optionally setup() and check(resp), see the README").PlaceHolder("FILE").ExistingFile()
+	dataFile     = kingpin.Flag("data", "CSV or JSON Lines (.jsonl) file, every request takes one row and reads its columns with {{data \"COLUMN\"}}").PlaceHolder("FILE").ExistingFile()
+	dataMode     = kingpin.Flag("data-mode", "How requests pick the next row of --data: sequential, random or unique (shuffled, each row once per pass)").Default("sequential").Enum(dataModes...)
+	dataStop     = kingpin.Flag("data-stop", "Stop when every row of --data has been used once").Bool()
+
+	h2           = kingpin.Flag("h2", "Use HTTP/2, negotiated via ALPN for https and with prior knowledge (h2c) for http").Bool()
+	h2Conns      = kingpin.Flag("h2-conns", "Number of HTTP/2 connections shared by all workers").Default("1").Int()
+	h2MaxStreams = kingpin.Flag("h2-max-streams", "Maximum concurrent streams per HTTP/2 connection").Default("100").Int()
+	h3           = kingpin.Flag("h3", "Use HTTP/3 over QUIC, requires an https url").Bool()
+
+	wsMessages = kingpin.Flag("ws-message", "Message sent on each ws:// or wss:// connection in order, each one waits for a reply, the sequence is repeated until the end").PlaceHolder("TEXT").Strings()
+	wsBinary   = kingpin.Flag("ws-binary", "Send --ws-message as binary instead of text frames").Bool()
+
+	grpcMethod   = kingpin.Flag("grpc-method", "Call a gRPC method instead of sending HTTP requests, the request message is the JSON --body, example: package.Service/Method").PlaceHolder("METHOD").String()
+	grpcProtoset = kingpin.Flag("grpc-protoset", "Compiled descriptor set of the gRPC service (protoc --include_imports --descriptor_set_out), server reflection is used if not set").PlaceHolder("FILE").ExistingFile()
+
+	expectStatus       = kingpin.Flag("expect-status", "Expected response status, such as 200 or 2xx, any of them must match").PlaceHolder("CODE").Strings()
+	expectBodyContains = kingpin.Flag("expect-body-contains", "Text the response body must contain").PlaceHolder("TEXT").Strings()
+	expectBodyRegex    = kingpin.Flag("expect-body-regex", "Regular expression the response body must match").PlaceHolder("REGEX").Strings()
+	expectHeader       = kingpin.Flag("expect-header", "Response header that must be present, with an optional exact value").PlaceHolder("K[:V]").Strings()
+	expectJSONPath     = kingpin.Flag("expect-json-path", "JSON path in the response body that must exist, with an optional value, examples: data.id, data.items[0].name=foo").PlaceHolder("PATH[=VALUE]").Strings()
+	thresholds         = kingpin.Flag("threshold", "Pass/fail condition checked at the end, exit with non-zero status if any fails, examples: p99<250ms, rps>1000, error_rate<0.1%, 5xx<10").PlaceHolder("EXPR").Strings()
+
+	chartsListenAddr = kingpin.Flag("listen", "Listen addr to serve Web UI and the Prometheus metrics at /metrics").Default(":18888").String()
 	timeout          = kingpin.Flag("timeout", "Timeout for each http request").PlaceHolder("DURATION").Duration()
 	dialTimeout      = kingpin.Flag("dial-timeout", "Timeout for dial addr").PlaceHolder("DURATION").Duration()
 	reqWriteTimeout  = kingpin.Flag("req-timeout", "Timeout for full request writing").PlaceHolder("DURATION").Duration()
 	respReadTimeout  = kingpin.Flag("resp-timeout", "Timeout for full response reading").PlaceHolder("DURATION").Duration()
 	socks5           = kingpin.Flag("socks5", "Socks5 proxy").PlaceHolder("ip:port").String()
 	httpProxy        = kingpin.Flag("http-proxy","Set HTTP proxy").PlaceHolder("username:password@ip:port").String()
+	resolve          = kingpin.Flag("resolve", "Connect to ADDR for HOST:PORT like curl, the url keeps its SNI and Host header, example: --resolve example.com:443:10.0.0.1").PlaceHolder("HOST:PORT:ADDR").Strings()
+	dnsServer        = kingpin.Flag("dns-server", "DNS server to look the hosts up with instead of the system resolver").PlaceHolder("ip[:port]").String()
+	dnsMode          = kingpin.Flag("dns-mode", "Look a host up once and pin all its connections to that address, or on every new connection: once or per-conn").Default("per-conn").Enum(dnsModes...)
 
 	autoOpenBrowser = kingpin.Flag("auto-open-browser", "Specify whether auto open browser to show web charts").Bool()
 	clean           = kingpin.Flag("clean", "Clean the histogram bar once its finished. Default is true").Default("true").NegatableBool()
 	outputErrors    = kingpin.Flag("output-errors", "Output errors to file").String()
+	reportOut       = kingpin.Flag("report-out", "Write the final report to a file, with the run configuration, every status code and error, and the durations in nanoseconds").PlaceHolder("FILE").String()
+	reportFormat    = kingpin.Flag("report-format", "Format of --report-out: json, csv, junit, markdown or html").Default("json").Enum(reportFormats...)
+	rawOut          = kingpin.Flag("raw-out", "Write every request with its start time, latency, status, body size, error, worker and label to a file, 'plow analyze FILE' rebuilds the report from it").PlaceHolder("FILE").String()
+	rawFormat       = kingpin.Flag("raw-format", "Format of --raw-out: csv or binary").Default("csv").Enum(rawFormats...)
+	push            = kingpin.Flag("push", "Push the metrics of every --push-interval to statsd://HOST:PORT, influx+udp://HOST:PORT, influx+http(s)://HOST:PORT/WRITE-PATH or otlp+http(s)://HOST:PORT[/PATH]").PlaceHolder("URL").Strings()
+	pushInterval    = kingpin.Flag("push-interval", "Interval of --push").Default("10s").Duration()
+	pushTags        = kingpin.Flag("push-tag", "Tag of the pushed metrics, next to run_id").PlaceHolder("K=V").Strings()
+	pushHeaders     = kingpin.Flag("push-header", "Header of the influx and otlp HTTP pushes, example: 'Authorization: Token XYZ'").PlaceHolder("K:V").Strings()
+	runID           = kingpin.Flag("run-id", "Id of the run tagging the pushed metrics, random by default").String()
+	baseline        = kingpin.Flag("baseline", "JSON --report-out file of an earlier run, print the deltas of the final report against it").PlaceHolder("FILE").ExistingFile()
+	tolerance       = kingpin.Flag("tolerance", "How much worse in percent RPS and latencies may get than --baseline before they are highlighted as regressions").Default("10%").String()
+	rateTolerance   = kingpin.Flag("rate-tolerance", "How many percentage points the error rate and the error statuses may grow over --baseline before they are highlighted as regressions").Default("1%").String()
+	failRegression  = kingpin.Flag("fail-on-regression", "Exit with non-zero status if any metric regressed against --baseline").Bool()
 	summary         = kingpin.Flag("summary", "Only print the summary without realtime reports").Default("false").Bool()
 	pprofAddr       = kingpin.Flag("pprof", "Enable pprof at special address").Hidden().String()
-	url             = kingpin.Arg("url", "Request url").Required().String()
+	urls            = kingpin.Arg("url", "Request url, several urls spread the requests across them with --targets-mode").Strings()
 	unixSocket      = kingpin.Flag("unix-socket", "Unix domain socket path to use for connection").String()
 )
 
@@ -96,6 +155,8 @@ Examples:
 
   plow http://127.0.0.1:8080/ -c 20 -n 100000
   plow https://httpbin.org/post -c 20 -d 5m --body @file.json -T 'application/json' -m POST
+  plow analyze raw.csv
+  plow compare baseline.json current.json --fail-on-regression
 
 {{if .Context.Flags -}}
 {{T "Flags:"}}
@@ -181,7 +242,118 @@ func rateFlag(c *kingpin.Clause) (target *rateFlagValue) {
 	return
 }
 
+// analyze is the "plow analyze FILE" command, it prints the report rebuilt
+// from a --raw-out log.
+func analyze(args []string) {
+	app := kingpin.New("plow analyze", "Rebuild the report of a --raw-out log")
+	file := app.Arg("file", "Log written by --raw-out, in either format").Required().ExistingFile()
+	asJSON := app.Flag("json", "Print the report as JSON").Bool()
+	useSeconds := app.Flag("seconds", "Use seconds as time unit to print").Bool()
+	exprs := app.Flag("threshold", "Pass/fail condition checked against the report, exit with non-zero status if any fails").PlaceHolder("EXPR").Strings()
+	out := app.Flag("report-out", "Write the report to a file").PlaceHolder("FILE").String()
+	format := app.Flag("report-format", "Format of --report-out: json, csv, junit, markdown or html").Default("json").Enum(reportFormats...)
+	kingpin.MustParse(app.Parse(args))
+
+	var thresholdList []*Threshold
+	for _, expr := range *exprs {
+		t, err := ParseThreshold(expr)
+		if err != nil {
+			errAndExit(err.Error())
+			return
+		}
+		thresholdList = append(thresholdList, t)
+	}
+	report, err := AnalyzeRawLog(*file)
+	if err != nil {
+		errAndExit(err.Error())
+		return
+	}
+	printer := NewPrinter(0, 0, false, true)
+	printer.thresholds = thresholdList
+	finalReport := printer.PrintLoop(report.Snapshot, 0, *useSeconds, *asJSON, report.Done())
+
+	if *out != "" {
+		config := &RunConfig{
+			Description: "Analyzing " + *file,
+			Started:     time.Unix(0, atomic.LoadInt64(&startTimeUnixNano)),
+			Version:     version,
+		}
+		if err := WriteReportFile(*out, *format, NewExportedReport(config, finalReport, thresholdList)); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+	}
+	if _, failed := CheckThresholds(thresholdList, finalReport); failed > 0 {
+		errAndExit(fmt.Sprintf("%d of %d threshold(s) failed", failed, len(thresholdList)))
+	}
+}
+
+// parseTolerances parses --tolerance and --rate-tolerance.
+func parseTolerances(tolerance, rateTolerance string) (float64, float64, error) {
+	t, err := parsePercent(tolerance)
+	if err != nil {
+		return 0, 0, err
+	}
+	rt, err := parsePercent(rateTolerance)
+	if err != nil {
+		return 0, 0, err
+	}
+	return t, rt, nil
+}
+
+// printComparison prints the deltas of current against baseline and
+// returns the number of regressions.
+func printComparison(baseline, current *SnapshotReport, tolerance, rateTolerance float64, useSeconds, asJSON bool) int {
+	cmps := Compare(baseline, current, tolerance, rateTolerance)
+	var buf bytes.Buffer
+	FormatComparison(&buf, cmps, useSeconds, asJSON)
+	_, _ = os.Stdout.Write(buf.Bytes())
+	return Regressions(cmps)
+}
+
+// compare is the "plow compare BASELINE CURRENT" command, it prints the
+// deltas between two JSON --report-out files.
+func compare(args []string) {
+	app := kingpin.New("plow compare", "Compare two JSON --report-out files")
+	baselineFile := app.Arg("baseline", "Report of the reference run").Required().ExistingFile()
+	currentFile := app.Arg("current", "Report of the run to check").Required().ExistingFile()
+	asJSON := app.Flag("json", "Print the comparison as JSON").Bool()
+	useSeconds := app.Flag("seconds", "Use seconds as time unit to print").Bool()
+	tolerance := app.Flag("tolerance", "How much worse in percent RPS and latencies may get before they are highlighted as regressions").Default("10%").String()
+	rateTolerance := app.Flag("rate-tolerance", "How many percentage points the error rate and the error statuses may grow before they are highlighted as regressions").Default("1%").String()
+	failRegression := app.Flag("fail-on-regression", "Exit with non-zero status if any metric regressed").Bool()
+	kingpin.MustParse(app.Parse(args))
+
+	t, rt, err := parseTolerances(*tolerance, *rateTolerance)
+	if err != nil {
+		errAndExit(err.Error())
+		return
+	}
+	b, err := LoadExportedReport(*baselineFile)
+	if err != nil {
+		errAndExit(err.Error())
+		return
+	}
+	c, err := LoadExportedReport(*currentFile)
+	if err != nil {
+		errAndExit(err.Error())
+		return
+	}
+	if n := printComparison(b.Report, c.Report, t, rt, *useSeconds, *asJSON); n > 0 && *failRegression {
+		errAndExit(fmt.Sprintf("%d metric(s) regressed", n))
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		analyze(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		compare(os.Args[2:])
+		return
+	}
+
 	kingpin.UsageTemplate(CompactUsageTemplate).
 		Version(version).
 		Author("six-ddc@github").
@@ -189,10 +361,24 @@ func main() {
 		Help = `A high-performance HTTP benchmarking tool with real-time web UI and terminal displaying`
 	kingpin.Parse()
 
-	if *requests >= 0 && *requests < int64(*concurrency) {
-		errAndExit("requests must greater than or equal concurrency")
+	var targets []*Target
+	for _, u := range *urls {
+		targets = append(targets, &Target{URL: u, Weight: 1})
+	}
+	if *targetsFile != "" {
+		fileTargets, err := LoadTargetsFile(*targetsFile)
+		if err != nil {
+			errAndExit(err.Error())
+			return
+		}
+		targets = append(targets, fileTargets...)
+	}
+	if len(targets) == 0 {
+		errAndExit("required argument 'url' not provided")
 		return
 	}
+	url := targets[0].URL
+
 	if (*cert != "" && *key == "") || (*cert == "" && *key != "") {
 		errAndExit("must specify cert and key at the same time")
 		return
@@ -240,13 +426,129 @@ func main() {
 		}
 	}
 
+	assertions, err := NewAssertions(*expectStatus, *expectBodyContains, *expectBodyRegex, *expectHeader, *expectJSONPath)
+	if err != nil {
+		errAndExit(err.Error())
+		return
+	}
+
+	var thresholdList []*Threshold
+	for _, expr := range *thresholds {
+		t, err := ParseThreshold(expr)
+		if err != nil {
+			errAndExit(err.Error())
+			return
+		}
+		thresholdList = append(thresholdList, t)
+	}
+
+	var baselineReport *ExportedReport
+	var tol, rateTol float64
+	if *baseline != "" {
+		if tol, rateTol, err = parseTolerances(*tolerance, *rateTolerance); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+		if baselineReport, err = LoadExportedReport(*baseline); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+	}
+
+	var pusher *Pusher
+	if len(*push) > 0 {
+		if *runID == "" {
+			*runID = NewRunID()
+		}
+		tags, err := ParsePushTags(*runID, *pushTags)
+		if err != nil {
+			errAndExit(err.Error())
+			return
+		}
+		if pusher, err = NewPusher(*push, *pushHeaders, tags, *pushInterval); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+	}
+
+	var stageList, rateStageList []Stage
+	if *stages != "" {
+		if stageList, err = ParseStages(*stages); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+		*concurrency = 1
+		for _, s := range stageList {
+			if int(s.Target) > *concurrency {
+				*concurrency = int(s.Target)
+			}
+		}
+	}
+	if *rateStages != "" {
+		if rateStageList, err = ParseStages(*rateStages); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+	}
+	if *duration == 0 && (stageList != nil || rateStageList != nil) {
+		*duration = stagesDuration(stageList)
+		if d := stagesDuration(rateStageList); d > *duration {
+			*duration = d
+		}
+	}
+	// --stages sets the concurrency to its highest target
+	if *requests >= 0 && *requests < int64(*concurrency) {
+		errAndExit("requests must greater than or equal concurrency")
+		return
+	}
+
+	var data *DataSet
+	if *dataFile != "" {
+		if data, err = LoadDataFile(*dataFile, *dataMode, *dataStop); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+	}
+
 	clientOpt := ClientOpt{
-		url:       *url,
+		url:       url,
 		method:    *method,
 		headers:   *headers,
 		bodyBytes: bodyBytes,
 		bodyFile:  bodyFile,
 
+		targets:      targets,
+		targetsMode:  *targetsMode,
+		requestsFile: *requestsFile,
+		scenarioFile: *scenarioFile,
+		scriptFile:   *scriptFile,
+		requestsMode: *requestsMode,
+		assertions:   assertions,
+
+		h2:           *h2,
+		h2Conns:      *h2Conns,
+		h2MaxStreams: *h2MaxStreams,
+		h3:           *h3,
+
+		openModel:   *openModel,
+		maxInflight: *maxInflight,
+		stages:      stageList,
+		rateStages:  rateStageList,
+
+		data: data,
+
+		cookies:    *cookies,
+		cookieFile: *cookieFile,
+
+		followRedirects: *followRedirects,
+		timings:         *timings,
+
+		wsMessages: *wsMessages,
+		wsBinary:   *wsBinary,
+
+		grpcMethod:   *grpcMethod,
+		grpcProtoset: *grpcProtoset,
+
 		certPath: *cert,
 		keyPath:  *key,
 		insecure: *insecure,
@@ -257,8 +559,15 @@ func main() {
 		writeTimeout: *reqWriteTimeout,
 		dialTimeout:  *dialTimeout,
 
+		disableKeepAlive:   *disableKeepAlive,
+		maxRequestsPerConn: *maxRequestsPerConn,
+		connMaxLifetime:    *connMaxLifetime,
+
 		socks5Proxy: *socks5,
 		httpProxy:   *httpProxy,
+		resolve:     *resolve,
+		dnsServer:   *dnsServer,
+		dnsMode:     *dnsMode,
 		contentType: *contentType,
 		host:        *host,
 		unixSocket:  *unixSocket,
@@ -272,17 +581,53 @@ func main() {
 
 	// description
 	var desc string
-	desc = fmt.Sprintf("Benchmarking %s", *url)
-	if *requests > 0 {
+	desc = fmt.Sprintf("Benchmarking %s", url)
+	if requester.targets != nil {
+		desc = fmt.Sprintf("Benchmarking %d targets (%s)", requester.targets.Len(), *targetsMode)
+	}
+	if requester.requestSet != nil {
+		desc += fmt.Sprintf(" (%d requests from %s, %s)", requester.requestSet.Len(), *requestsFile, *requestsMode)
+	}
+	if requester.scenario != nil {
+		desc += fmt.Sprintf(" (%d steps from %s)", requester.scenario.Len(), *scenarioFile)
+	}
+	if requester.script != nil {
+		desc += fmt.Sprintf(" (requests from %s)", *scriptFile)
+	}
+	if data != nil {
+		desc += fmt.Sprintf(" (%d rows from %s, %s)", data.Len(), *dataFile, *dataMode)
+	}
+	if *requests > 0 && requester.scenario != nil {
+		desc += fmt.Sprintf(" with %d journey(s)", *requests)
+	} else if *requests > 0 {
 		desc += fmt.Sprintf(" with %d request(s)", *requests)
 	}
 	if *duration > 0 {
 		desc += fmt.Sprintf(" for %s", duration.String())
 	}
-	if *rampUp > 0 {
+	if *rampUp > 0 && !*openModel {
 		desc += fmt.Sprintf(" with ramp up %d pre second", *rampUp)
 	}
-	desc += fmt.Sprintf(" using %d connection(s).", *concurrency)
+	if *stages != "" {
+		desc += fmt.Sprintf(" with stages %s", *stages)
+	}
+	if *rateStages != "" {
+		desc += fmt.Sprintf(" with rate stages %s", *rateStages)
+	}
+	if *openModel {
+		desc += fmt.Sprintf(" at %s request(s)/s with up to %d in flight", formatFloat64(float64(*reqRate.Limit())), *maxInflight)
+	}
+	if *h2 {
+		desc += fmt.Sprintf(" using %d worker(s) over %d HTTP/2 connection(s) with up to %d stream(s) each.", *concurrency, *h2Conns, *h2MaxStreams)
+	} else if requester.grpc != nil {
+		desc += fmt.Sprintf(" calling %s using %d gRPC connection(s).", requester.grpc.method, *concurrency)
+	} else if requester.ws != nil {
+		desc += fmt.Sprintf(" using %d websocket connection(s).", *concurrency)
+	} else if *h3 {
+		desc += fmt.Sprintf(" using %d worker(s) over HTTP/3.", *concurrency)
+	} else {
+		desc += fmt.Sprintf(" using %d connection(s).", *concurrency)
+	}
 	fmt.Fprintln(os.Stderr, desc)
 
 	// charts listener
@@ -295,6 +640,9 @@ func main() {
 		}
 		fmt.Fprintf(os.Stderr, "@ Real-time charts is listening on http://%s\n", ln.Addr().String())
 	}
+	if pusher != nil {
+		fmt.Fprintf(os.Stderr, "@ Pushing metrics every %s with run_id %s\n", *pushInterval, *runID)
+	}
 	fmt.Fprintln(os.Stderr, "")
 
 	// do request
@@ -302,7 +650,17 @@ func main() {
 
 	// metrics collection
 	report := NewStreamReport()
+	if *rawOut != "" {
+		report.raw, err = NewRawWriter(*rawOut, *rawFormat)
+		if err != nil {
+			errAndExit(err.Error())
+			return
+		}
+	}
 	go report.Collect(requester.RecordChan())
+	if pusher != nil {
+		go pusher.Run(report, report.Done())
+	}
 
 	if ln != nil {
 		// serve charts data
@@ -311,10 +669,83 @@ func main() {
 			errAndExit(err.Error())
 			return
 		}
+		if requester.requestSet != nil || requester.targets != nil || requester.ws != nil || requester.scenario != nil || requester.script != nil {
+			charts.AddLabelView()
+		}
+		if *timings {
+			charts.AddTimingView()
+		}
+		charts.AddMetrics(report.WriteMetrics)
 		go charts.Serve(*autoOpenBrowser)
 	}
 
 	// terminal printer
-	printer := NewPrinter(*requests, *duration, !*clean, *summary)
-	printer.PrintLoop(report.Snapshot, *interval, *seconds, *jsonFormat, report.Done())
+	maxNum := *requests
+	if requester.scenario != nil && maxNum > 0 {
+		// -n counts journeys, the progress counts requests
+		maxNum *= int64(requester.scenario.Len())
+	}
+	printer := NewPrinter(maxNum, *duration, !*clean, *summary)
+	printer.thresholds = thresholdList
+	printer.openModel = *openModel
+	if baselineReport != nil && *jsonFormat {
+		// a single JSON document holds the report and the comparison
+		printer.compare = func(final *SnapshotReport) []*Comparison {
+			return Compare(baselineReport.Report, final, tol, rateTol)
+		}
+	}
+	finalReport := printer.PrintLoop(report.Snapshot, *interval, *seconds, *jsonFormat, report.Done())
+
+	if report.raw != nil {
+		if err := report.raw.Close(); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+	}
+	if pusher != nil {
+		for _, err := range pusher.Wait() {
+			fmt.Fprintln(os.Stderr, "plow: "+err.Error())
+		}
+	}
+
+	if *reportOut != "" {
+		config := &RunConfig{
+			Description: desc,
+			Method:      *method,
+			Concurrency: *concurrency,
+			Requests:    *requests,
+			Duration:    *duration,
+			Timeout:     *timeout,
+			Started:     time.Unix(0, atomic.LoadInt64(&startTimeUnixNano)),
+			Version:     version,
+		}
+		for _, t := range targets {
+			config.URLs = append(config.URLs, t.URL)
+		}
+		if limit := reqRate.Limit(); limit != nil {
+			config.Rate = float64(*limit)
+		}
+		if err := WriteReportFile(*reportOut, *reportFormat, NewExportedReport(config, finalReport, thresholdList)); err != nil {
+			errAndExit(err.Error())
+			return
+		}
+	}
+
+	regressions := 0
+	if baselineReport != nil {
+		if *jsonFormat {
+			regressions = Regressions(printer.compare(finalReport))
+		} else {
+			fmt.Println()
+			regressions = printComparison(baselineReport.Report, finalReport, tol, rateTol, *seconds, false)
+		}
+	}
+
+	if _, failed := CheckThresholds(thresholdList, finalReport); failed > 0 {
+		errAndExit(fmt.Sprintf("%d of %d threshold(s) failed", failed, len(thresholdList)))
+		return
+	}
+	if regressions > 0 && *failRegression {
+		errAndExit(fmt.Sprintf("%d metric(s) regressed against the baseline", regressions))
+	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metricsBuckets are the upper bounds in seconds of the latency histogram
+// served at /metrics, finer than the Prometheus defaults at the low end as
+// benchmarked servers often answer within a millisecond.
+var metricsBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricsBucket returns the index in metricsBuckets of the first bound
+// holding the latency v in nanoseconds, len(metricsBuckets) past the last.
+func metricsBucket(v float64) int {
+	return sort.SearchFloat64s(metricsBuckets, v/1e9)
+}
+
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeMetricHeader(w *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeLabeledCounters(w *bytes.Buffer, name, label string, m map[string]int64) {
+	for _, k := range sortedKeys(m) {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, metricsLabelEscaper.Replace(k), m[k])
+	}
+}
+
+// metricsErrorClass maps an error to the class it is counted under at
+// /metrics, the messages hold addresses and ports that would make a series
+// each.
+func metricsErrorClass(err string) string {
+	switch {
+	case strings.Contains(err, "timeout") || strings.Contains(err, "timed out") || strings.Contains(err, "deadline exceeded"):
+		return "timeout"
+	case strings.Contains(err, "connection refused"):
+		return "connection refused"
+	case strings.Contains(err, "tls:") || strings.Contains(err, "x509:"):
+		return "tls"
+	}
+	return "other"
+}
+
+// WriteMetrics writes the counters of the report so far in the Prometheus
+// text exposition format.
+func (s *StreamReport) WriteMetrics(w *bytes.Buffer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	writeMetricHeader(w, "plow_requests_total", "counter", "Requests answered, by status code.")
+	writeLabeledCounters(w, "plow_requests_total", "code", chartCodes(s.codes))
+
+	writeMetricHeader(w, "plow_request_errors_total", "counter", "Requests failed, by error class: timeout, connection refused, tls or other.")
+	classes := make(map[string]int64)
+	for err, n := range s.errors {
+		classes[metricsErrorClass(err)] += n
+	}
+	writeLabeledCounters(w, "plow_request_errors_total", "error", classes)
+
+	writeMetricHeader(w, "plow_request_duration_seconds", "histogram", "Latency of the requests.")
+	var cumulative int64
+	for i, le := range metricsBuckets {
+		cumulative += s.latencyBuckets[i]
+		fmt.Fprintf(w, "plow_request_duration_seconds_bucket{le=\"%s\"} %d\n", formatFloat64(le), cumulative)
+	}
+	fmt.Fprintf(w, "plow_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", s.latencyStats.count)
+	fmt.Fprintf(w, "plow_request_duration_seconds_sum %s\n", strconv.FormatFloat(s.latencyStats.sum/1e9, 'g', -1, 64))
+	fmt.Fprintf(w, "plow_request_duration_seconds_count %d\n", s.latencyStats.count)
+
+	writeMetricHeader(w, "plow_concurrency", "gauge", "Workers running, each with at most one request in flight.")
+	fmt.Fprintf(w, "plow_concurrency %d\n", s.concurrencyCount)
+
+	writeMetricHeader(w, "plow_read_bytes_total", "counter", "Bytes read from the connections.")
+	fmt.Fprintf(w, "plow_read_bytes_total %d\n", s.readBytes)
+	writeMetricHeader(w, "plow_written_bytes_total", "counter", "Bytes written to the connections.")
+	fmt.Fprintf(w, "plow_written_bytes_total %d\n", s.writeBytes)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamReportWriteMetrics(t *testing.T) {
+	records := make(chan *ReportRecord, 4)
+	records <- &ReportRecord{cost: 300 * time.Microsecond, code: 200}
+	records <- &ReportRecord{cost: 3 * time.Millisecond, code: 200}
+	records <- &ReportRecord{cost: 20 * time.Second, code: 503}
+	records <- &ReportRecord{cost: time.Millisecond, error: "read \"a\"\nb", readBytes: 300, writeBytes: 120, concurrencyCount: 3}
+	close(records)
+	report := NewStreamReport()
+	report.Collect(records)
+
+	var buf bytes.Buffer
+	report.WriteMetrics(&buf)
+	got := buf.String()
+	for _, want := range []string{
+		"# TYPE plow_requests_total counter\n",
+		"plow_requests_total{code=\"200\"} 2\n",
+		"plow_requests_total{code=\"503\"} 1\n",
+		"plow_request_errors_total{error=\"other\"} 1\n",
+		"# TYPE plow_request_duration_seconds histogram\n",
+		"plow_request_duration_seconds_bucket{le=\"0.0005\"} 1\n",
+		"plow_request_duration_seconds_bucket{le=\"0.001\"} 2\n",
+		"plow_request_duration_seconds_bucket{le=\"0.005\"} 3\n",
+		"plow_request_duration_seconds_bucket{le=\"10\"} 3\n",
+		"plow_request_duration_seconds_bucket{le=\"+Inf\"} 4\n",
+		"plow_request_duration_seconds_sum 20.0043\n",
+		"plow_request_duration_seconds_count 4\n",
+		"plow_concurrency 3\n",
+		"plow_read_bytes_total 300\n",
+		"plow_written_bytes_total 120\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("metrics miss %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestChartsHandlerServesMetrics(t *testing.T) {
+	charts := newTestCharts(t, func() *ChartsReport { return nil })
+	if resp := handleChartRequest(charts, metricsPath); resp.StatusCode() != 404 {
+		t.Fatalf("/metrics status = %d without AddMetrics, want 404", resp.StatusCode())
+	}
+
+	charts.AddMetrics(NewStreamReport().WriteMetrics)
+	resp := handleChartRequest(charts, metricsPath)
+	if resp.StatusCode() != 200 || !strings.HasPrefix(string(resp.Header.ContentType()), "text/plain; version=0.0.4") {
+		t.Fatalf("/metrics status = %d content-type = %q", resp.StatusCode(), resp.Header.ContentType())
+	}
+	if !strings.Contains(string(resp.Body()), "plow_request_duration_seconds_count 0\n") {
+		t.Fatalf("/metrics body:\n%s", resp.Body())
+	}
+}
+
+func TestMetricsErrorClass(t *testing.T) {
+	for err, want := range map[string]string{
+		"timeout":                                              "timeout",
+		"dial tcp 10.0.0.1:80: i/o timeout":                    "timeout",
+		"dialing to the given TCP address timed out":           "timeout",
+		"dial tcp 127.0.0.1:8080: connect: connection refused": "connection refused",
+		"tls: failed to verify certificate: x509: certificate signed by unknown authority": "tls",
+		"the server closed connection before returning the first response byte":            "other",
+	} {
+		if got := metricsErrorClass(err); got != want {
+			t.Fatalf("metricsErrorClass(%q) = %q, want %q", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// runOpenModel sends requests at the --rate arrival rate no matter how
+// fast the server answers. Every request has an intended send time on a
+// fixed schedule, and its latency is measured from that time so that a
+// stalled server shows up in the percentiles instead of slowing down the
+// sender (coordinated omission). Requests are handed to idle workers, more
+// workers are started when none is idle, and once --max-inflight requests
+// are in flight the next ones are dropped, they still count towards -n and
+// every one of them is reported.
+func (r *Requester) runOpenModel(ctx context.Context) {
+	interval := time.Duration(float64(time.Second) / float64(*r.reqRate))
+	if interval <= 0 {
+		interval = 1
+	}
+	maxInflight := r.clientOpt.maxInflight
+	if maxInflight < r.concurrency {
+		maxInflight = r.concurrency
+	}
+
+	intents := make(chan time.Time)
+	workers := 0
+	spawn := func() {
+		workers++
+		id := workers
+		r.wg.Add(1)
+		go func() {
+			defer func() {
+				r.wg.Done()
+				v := recover()
+				if v != nil && v != sendOnCloseError {
+					panic(v)
+				}
+			}()
+			req := r.newRequest()
+			resp := &fasthttp.Response{}
+			ts := r.newTemplateState()
+			jar := r.newCookieJar()
+			tr := r.newRequestTrace()
+			for intended := range intents {
+				if time.Since(intended) > interval {
+					atomic.AddInt64(&r.late, 1)
+				}
+				rr := recordPool.Get().(*ReportRecord)
+				label, err := r.prepareRequest(req, ts)
+				if err == errDataExhausted {
+					recordPool.Put(rr)
+					atomic.AddInt64(&r.concurrencyCount, -1)
+					r.Cancel()
+					continue
+				}
+				if err != nil {
+					rr.code = 0
+					rr.error = err.Error()
+				} else {
+					resp.Reset()
+					r.doRequest(req, resp, rr, jar, tr)
+				}
+				rr.cost = time.Since(intended)
+				r.sendRecord(rr, label, id)
+				atomic.AddInt64(&r.concurrencyCount, -1)
+			}
+		}()
+	}
+	for i := 0; i < r.concurrency; i++ {
+		spawn()
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	start := time.Now()
+	for i := int64(0); r.requests <= 0 || i < r.requests; i++ {
+		intended := start.Add(time.Duration(i) * interval)
+		if d := time.Until(intended); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				close(intents)
+				return
+			}
+		} else if ctx.Err() != nil {
+			close(intents)
+			return
+		}
+
+		// concurrencyCount is the requests in flight, the workers
+		// decrement it once their request is reported
+		if atomic.AddInt64(&r.concurrencyCount, 1) > int64(maxInflight) {
+			atomic.AddInt64(&r.concurrencyCount, -1)
+			atomic.AddInt64(&r.dropped, 1)
+			r.sendShed()
+			continue
+		}
+		select {
+		case intents <- intended:
+			continue
+		default:
+		}
+		// a worker that is done is about to be idle again past the limit
+		if workers < maxInflight {
+			spawn()
+		}
+		intents <- intended
+	}
+	close(intents)
+}
+
+// sendShed reports an arrival dropped by the open model, the record
+// channel may be closed already once the --duration is over.
+func (r *Requester) sendShed() {
+	defer func() {
+		if v := recover(); v != nil && v != sendOnCloseError {
+			panic(v)
+		}
+	}()
+	rr := recordPool.Get().(*ReportRecord)
+	rr.cost = 0
+	rr.code = 0
+	rr.error = ""
+	rr.shed = true
+	r.sendRecord(rr, "", 0)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/time/rate"
+)
+
+// slowHandler answers every request after delay.
+func slowHandler(delay time.Duration) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(delay)
+	}
+}
+
+func runOpenModel(t *testing.T, url string, limit rate.Limit, concurrency, maxInflight int, requests int64) (*Requester, []*ReportRecord) {
+	t.Helper()
+	requester, err := NewRequester(concurrency, requests, 0, &limit, io.Discard, &ClientOpt{
+		url:         url,
+		method:      fasthttp.MethodGet,
+		openModel:   true,
+		maxInflight: maxInflight,
+		maxConns:    maxInflight,
+		dialTimeout: time.Second,
+		doTimeout:   5 * time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return requester, collectRecords(t, requester)
+}
+
+func TestOpenModelSpawnsWorkersUpToMaxInflight(t *testing.T) {
+	url := "http://" + startServer(t, slowHandler(50*time.Millisecond)) + "/"
+	_, records := runOpenModel(t, url, 100, 1, 20, 20)
+	if len(records) != 20 {
+		t.Fatalf("got %d records, want 20", len(records))
+	}
+	maxWorkers := 0
+	for _, rr := range records {
+		if rr.code != fasthttp.StatusOK {
+			t.Fatalf("record = code %d error %q, want 200", rr.code, rr.error)
+		}
+		if rr.cost < 50*time.Millisecond {
+			t.Fatalf("latency %s is shorter than the server delay", rr.cost)
+		}
+		if rr.concurrencyCount > maxWorkers {
+			maxWorkers = rr.concurrencyCount
+		}
+		if rr.dropped != 0 {
+			t.Fatalf("dropped = %d, want 0", rr.dropped)
+		}
+	}
+	if maxWorkers < 2 || maxWorkers > 20 {
+		t.Fatalf("%d workers were started, want more than one and at most 20", maxWorkers)
+	}
+}
+
+func TestOpenModelDropsBeyondMaxInflight(t *testing.T) {
+	url := "http://" + startServer(t, slowHandler(100*time.Millisecond)) + "/"
+	requester, records := runOpenModel(t, url, 200, 1, 2, 40)
+	dropped := requester.dropped
+	if dropped == 0 {
+		t.Fatal("no request was dropped, want the ones beyond --max-inflight")
+	}
+	if len(records) != 40 {
+		t.Fatalf("got %d records, want one per scheduled request", len(records))
+	}
+	var shed int64
+	for _, rr := range records {
+		if rr.shed {
+			shed++
+		}
+		if rr.concurrencyCount > 2 {
+			t.Fatalf("%d requests in flight, want at most 2", rr.concurrencyCount)
+		}
+	}
+	if shed != dropped {
+		t.Fatalf("got %d shed records, want the %d dropped", shed, dropped)
+	}
+	if last := records[len(records)-1]; last.dropped != dropped {
+		t.Fatalf("last record carries %d dropped, want %d", last.dropped, dropped)
+	}
+	if requester.concurrencyCount != 0 {
+		t.Fatalf("%d requests still in flight after the run, want 0", requester.concurrencyCount)
+	}
+}
+
+func TestOpenModelRequiresRate(t *testing.T) {
+	if _, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: "http://127.0.0.1/", openModel: true}, -1); err == nil {
+		t.Fatal("NewRequester succeeded with --open-model and no --rate, want error")
+	}
+}
+
+func TestPrinterFormatsOpenModelCounters(t *testing.T) {
+	snapshot := testSnapshotReport()
+	snapshot.Dropped = 7
+	printer := NewPrinter(3, 0, false, false)
+
+	var buf bytes.Buffer
+	printer.formatTableReports(&buf, snapshot, true, false)
+	if strings.Contains(buf.String(), "Dropped") {
+		t.Fatalf("open model counters printed without --open-model:\n%s", buf.String())
+	}
+
+	printer.openModel = true
+	buf.Reset()
+	printer.formatTableReports(&buf, snapshot, true, false)
+	for _, want := range []string{"Dropped", "7", "Late"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("table output is missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	printer.formatJSONReports(&buf, snapshot, true, false)
+	if !strings.Contains(buf.String(), `"Dropped": 7`) || !strings.Contains(buf.String(), `"Late": 0`) {
+		t.Fatalf("JSON output is missing the open model counters:\n%s", buf.String())
+	}
+}
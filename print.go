@@ -36,6 +36,11 @@ type Printer struct {
 	pbDurStr    string
 	noClean     bool
 	summary     bool
+	thresholds  []*Threshold
+	openModel   bool
+	// compare returns the deltas of the final report against --baseline,
+	// it is nil without one
+	compare func(*SnapshotReport) []*Comparison
 }
 
 func NewPrinter(maxNum int64, maxDuration time.Duration, noCleanBar, summary bool) *Printer {
@@ -55,6 +60,9 @@ func (p *Printer) updateProgressValue(rs *SnapshotReport) {
 	}
 	if p.maxNum > 0 {
 		p.curNum = rs.Count
+		if p.curNum > p.maxNum {
+			p.curNum = p.maxNum
+		}
 		if p.maxNum > 0 {
 			barLen := int((p.curNum*int64(maxBarLen-2) + p.maxNum/2) / p.maxNum)
 			p.pbNumStr = barStart + strings.Repeat(barBody, barLen) + strings.Repeat(" ", maxBarLen-2-barLen) + barEnd
@@ -65,7 +73,7 @@ func (p *Printer) updateProgressValue(rs *SnapshotReport) {
 	}
 }
 
-func (p *Printer) PrintLoop(snapshot func() *SnapshotReport, interval time.Duration, useSeconds bool, json bool, doneChan <-chan struct{}) {
+func (p *Printer) PrintLoop(snapshot func() *SnapshotReport, interval time.Duration, useSeconds bool, json bool, doneChan <-chan struct{}) *SnapshotReport {
 	var buf bytes.Buffer
 
 	var backCursor string
@@ -73,7 +81,7 @@ func (p *Printer) PrintLoop(snapshot func() *SnapshotReport, interval time.Durat
 	if p.summary || interval == 0 || !isTerminal {
 		cl = nil
 	}
-	echo := func(isFinal bool) {
+	echo := func(isFinal bool) *SnapshotReport {
 		report := snapshot()
 		p.updateProgressValue(report)
 		os.Stdout.WriteString(backCursor)
@@ -102,6 +110,7 @@ func (p *Printer) PrintLoop(snapshot func() *SnapshotReport, interval time.Durat
 		if isTerminal {
 			backCursor = fmt.Sprintf("\033[%dA", n)
 		}
+		return report
 	}
 
 	if interval > 0 {
@@ -121,7 +130,7 @@ func (p *Printer) PrintLoop(snapshot func() *SnapshotReport, interval time.Durat
 	} else {
 		<-doneChan
 	}
-	echo(true)
+	return echo(true)
 }
 
 // nolint
@@ -193,7 +202,7 @@ func formatFloat64(f float64) string {
 	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
-func (p *Printer) formatJSONReports(writer *bytes.Buffer, snapshot *SnapshotReport, _ bool, useSeconds bool) {
+func (p *Printer) formatJSONReports(writer *bytes.Buffer, snapshot *SnapshotReport, isFinal bool, useSeconds bool) {
 	indent := 0
 	writer.WriteString("{\n")
 	indent++
@@ -208,6 +217,22 @@ func (p *Printer) formatJSONReports(writer *bytes.Buffer, snapshot *SnapshotRepo
 	p.buildJSONPercentile(writer, snapshot, useSeconds, indent)
 	writer.WriteString(",\n")
 	p.buildJSONHistogram(writer, snapshot, useSeconds, indent)
+	if len(snapshot.Labels) != 0 {
+		writer.WriteString(",\n")
+		p.buildJSONLabels(writer, snapshot, useSeconds, indent)
+	}
+	if len(snapshot.Timings) != 0 {
+		writer.WriteString(",\n")
+		p.buildJSONTimings(writer, snapshot, useSeconds, indent)
+	}
+	if isFinal && len(p.thresholds) != 0 {
+		writer.WriteString(",\n")
+		p.buildJSONThresholds(writer, snapshot, useSeconds, indent)
+	}
+	if isFinal && p.compare != nil {
+		writer.WriteString(",\n")
+		buildJSONComparison(writer, p.compare(snapshot), useSeconds, indent)
+	}
 	writer.WriteString("\n}\n")
 }
 
@@ -237,6 +262,197 @@ func (p *Printer) formatTableReports(writer *bytes.Buffer, snapshot *SnapshotRep
 
 	writer.WriteString("Latency Histogram:\n")
 	writeBulk(writer, hisBulk)
+
+	if len(snapshot.Labels) != 0 {
+		writer.WriteString("\n")
+		writer.WriteString("Labels:\n")
+		writeBulk(writer, p.buildLabels(snapshot, useSeconds))
+	}
+
+	if len(snapshot.Timings) != 0 {
+		writer.WriteString("\n")
+		writer.WriteString("Timings:\n")
+		writeBulk(writer, p.buildTimings(snapshot, useSeconds))
+	}
+
+	if isFinal && len(p.thresholds) != 0 {
+		writer.WriteString("\n")
+		writer.WriteString("Thresholds:\n")
+		writeBulk(writer, p.buildThresholds(snapshot, useSeconds))
+	}
+}
+
+func (p *Printer) buildJSONThresholds(writer *bytes.Buffer, snapshot *SnapshotReport, useSeconds bool, indent int) {
+	tab0 := strings.Repeat("  ", indent)
+	writer.WriteString(tab0 + "\"Thresholds\": [\n")
+	tab1 := strings.Repeat("  ", indent+1)
+	results, _ := CheckThresholds(p.thresholds, snapshot)
+	for i, r := range results {
+		eb, _ := json.Marshal(r.expr)
+		ab, _ := json.Marshal(r.ActualString(useSeconds))
+		writer.WriteString(fmt.Sprintf(`%s{ "Threshold": %s, "Actual": %s, "Pass": %t }`, tab1, eb, ab, r.Pass))
+		if i != len(results)-1 {
+			writer.WriteString(",")
+		}
+		writer.WriteString("\n")
+	}
+	writer.WriteString(tab0 + "]")
+}
+
+func (p *Printer) buildThresholds(snapshot *SnapshotReport, useSeconds bool) [][]string {
+	var thresholdsBulk [][]string
+	results, _ := CheckThresholds(p.thresholds, snapshot)
+	for _, r := range results {
+		result := colorize("PASS", FgGreenColor)
+		if !r.Pass {
+			result = colorize("FAIL", FgRedColor)
+		}
+		thresholdsBulk = append(thresholdsBulk, []string{r.expr, r.ActualString(useSeconds), result})
+	}
+	alignBulk(thresholdsBulk, AlignLeft, AlignRight, AlignLeft)
+	return thresholdsBulk
+}
+
+var labelQuantiles = []float64{0.50, 0.90, 0.99}
+
+func (p *Printer) buildJSONLabels(writer *bytes.Buffer, snapshot *SnapshotReport, useSeconds bool, indent int) {
+	tab0 := strings.Repeat("  ", indent)
+	writer.WriteString(tab0 + "\"Labels\": [\n")
+	tab1 := strings.Repeat("  ", indent+1)
+	tab2 := strings.Repeat("  ", indent+2)
+	for i, label := range snapshot.Labels {
+		lb, _ := json.Marshal(label.Label)
+		writer.WriteString(tab1 + "{\n")
+		writer.WriteString(fmt.Sprintf("%s\"Label\": %s,\n", tab2, lb))
+		writer.WriteString(fmt.Sprintf("%s\"Count\": %d,\n", tab2, label.Count))
+		writer.WriteString(fmt.Sprintf("%s\"Counts\": {", tab2))
+		for j, v := range sortMapStrInt(label.Codes) {
+			if j != 0 {
+				writer.WriteString(",")
+			}
+			writer.WriteString(fmt.Sprintf(` "%s": %s`, v[0], v[1]))
+		}
+		writer.WriteString(" },\n")
+		writer.WriteString(fmt.Sprintf("%s\"RPS\": %.3f,\n", tab2, label.RPS))
+		writer.WriteString(fmt.Sprintf(`%s"Latency": { "Min": "%s", "Mean": "%s", "StdDev": "%s", "Max": "%s" },`+"\n",
+			tab2,
+			durationToString(label.Stats.Min, useSeconds),
+			durationToString(label.Stats.Mean, useSeconds),
+			durationToString(label.Stats.StdDev, useSeconds),
+			durationToString(label.Stats.Max, useSeconds),
+		))
+		writer.WriteString(fmt.Sprintf("%s\"Percentiles\": {", tab2))
+		for j, percentile := range label.Percentiles {
+			if j != 0 {
+				writer.WriteString(",")
+			}
+			writer.WriteString(fmt.Sprintf(` "P%s": "%s"`, formatFloat64(percentile.Percentile*100),
+				durationToString(percentile.Latency, useSeconds)))
+		}
+		writer.WriteString(" }\n")
+		writer.WriteString(tab1 + "}")
+		if i != len(snapshot.Labels)-1 {
+			writer.WriteString(",")
+		}
+		writer.WriteString("\n")
+	}
+	writer.WriteString(tab0 + "]")
+}
+
+func (p *Printer) buildLabels(snapshot *SnapshotReport, useSeconds bool) [][]string {
+	header := []string{"Label", "Count", "RPS", "Mean", "Max"}
+	for _, q := range labelQuantiles {
+		header = append(header, "P"+formatFloat64(q*100))
+	}
+	header = append(header, "Codes")
+	labelsBulk := [][]string{header}
+	for _, label := range snapshot.Labels {
+		row := []string{
+			label.Label,
+			strconv.FormatInt(label.Count, 10),
+			fmt.Sprintf("%.3f", label.RPS),
+			durationToString(label.Stats.Mean, useSeconds),
+			durationToString(label.Stats.Max, useSeconds),
+		}
+		for _, q := range labelQuantiles {
+			var latency time.Duration
+			for _, percentile := range label.Percentiles {
+				if percentile.Percentile == q {
+					latency = percentile.Latency
+				}
+			}
+			row = append(row, durationToString(latency, useSeconds))
+		}
+		var codes []string
+		for _, v := range sortMapStrInt(label.Codes) {
+			code := v[0] + ":" + v[1]
+			if v[0] != "2xx" {
+				code = colorize(code, FgMagentaColor)
+			}
+			codes = append(codes, code)
+		}
+		row = append(row, strings.Join(codes, " "))
+		labelsBulk = append(labelsBulk, row)
+	}
+	alignBulk(labelsBulk, AlignLeft, AlignRight, AlignRight, AlignRight, AlignRight, AlignRight, AlignRight, AlignRight, AlignLeft)
+	return labelsBulk
+}
+
+func (p *Printer) buildJSONTimings(writer *bytes.Buffer, snapshot *SnapshotReport, useSeconds bool, indent int) {
+	tab0 := strings.Repeat("  ", indent)
+	writer.WriteString(tab0 + "\"Timings\": [\n")
+	tab1 := strings.Repeat("  ", indent+1)
+	for i, phase := range snapshot.Timings {
+		writer.WriteString(fmt.Sprintf(`%s{ "Phase": "%s", "Count": %d, "Min": "%s", "Mean": "%s", "StdDev": "%s", "Max": "%s"`,
+			tab1, phase.Label, phase.Count,
+			durationToString(phase.Stats.Min, useSeconds),
+			durationToString(phase.Stats.Mean, useSeconds),
+			durationToString(phase.Stats.StdDev, useSeconds),
+			durationToString(phase.Stats.Max, useSeconds),
+		))
+		for _, percentile := range phase.Percentiles {
+			writer.WriteString(fmt.Sprintf(`, "P%s": "%s"`, formatFloat64(percentile.Percentile*100),
+				durationToString(percentile.Latency, useSeconds)))
+		}
+		writer.WriteString(" }")
+		if i != len(snapshot.Timings)-1 {
+			writer.WriteString(",")
+		}
+		writer.WriteString("\n")
+	}
+	writer.WriteString(tab0 + "]")
+}
+
+// buildTimings lists the phases of --timings, the connection phases only
+// count the requests that opened a connection.
+func (p *Printer) buildTimings(snapshot *SnapshotReport, useSeconds bool) [][]string {
+	header := []string{"Phase", "Count", "Min", "Mean", "StdDev", "Max"}
+	for _, q := range labelQuantiles {
+		header = append(header, "P"+formatFloat64(q*100))
+	}
+	timingsBulk := [][]string{header}
+	for _, phase := range snapshot.Timings {
+		row := []string{
+			phase.Label,
+			strconv.FormatInt(phase.Count, 10),
+			durationToString(phase.Stats.Min, useSeconds),
+			durationToString(phase.Stats.Mean, useSeconds),
+			durationToString(phase.Stats.StdDev, useSeconds),
+			durationToString(phase.Stats.Max, useSeconds),
+		}
+		for _, q := range labelQuantiles {
+			var latency time.Duration
+			for _, percentile := range phase.Percentiles {
+				if percentile.Percentile == q {
+					latency = percentile.Latency
+				}
+			}
+			row = append(row, durationToString(latency, useSeconds))
+		}
+		timingsBulk = append(timingsBulk, row)
+	}
+	alignBulk(timingsBulk, AlignLeft, AlignRight, AlignRight, AlignRight, AlignRight, AlignRight, AlignRight, AlignRight, AlignRight)
+	return timingsBulk
 }
 
 func (p *Printer) buildJSONHistogram(writer *bytes.Buffer, snapshot *SnapshotReport, useSeconds bool, indent int) {
@@ -433,10 +649,35 @@ func (p *Printer) buildJSONSummary(writer *bytes.Buffer, snapshot *SnapshotRepor
 			writer.WriteString("\n")
 		}
 		writer.WriteString(tab1 + "},\n")
+		if len(snapshot.Redirects) > 0 {
+			writer.WriteString(fmt.Sprintf("%s\"Redirects\": {\n", tab1))
+			redirects := sortMapStrInt(snapshot.Redirects)
+			for i, v := range redirects {
+				writer.WriteString(fmt.Sprintf(`%s"%s": %s`, tab2, v[0], v[1]))
+				if i != len(redirects)-1 {
+					writer.WriteString(",")
+				}
+				writer.WriteString("\n")
+			}
+			writer.WriteString(tab1 + "},\n")
+		}
+		if p.openModel {
+			writer.WriteString(fmt.Sprintf("%s\"Dropped\": %d,\n", tab1, snapshot.Dropped))
+			writer.WriteString(fmt.Sprintf("%s\"Late\": %d,\n", tab1, snapshot.Late))
+		}
 		writer.WriteString(fmt.Sprintf("%s\"RPS\": %.3f,\n", tab1, snapshot.RPS))
 		writer.WriteString(fmt.Sprintf("%s\"Concurrency\": %d,\n", tab1, snapshot.concurrencyCount))
 		writer.WriteString(fmt.Sprintf("%s\"Reads\": \"%.3fMB/s\",\n", tab1, snapshot.ReadThroughput))
-		writer.WriteString(fmt.Sprintf("%s\"Writes\": \"%.3fMB/s\"\n", tab1, snapshot.WriteThroughput))
+		writer.WriteString(fmt.Sprintf("%s\"Writes\": \"%.3fMB/s\"", tab1, snapshot.WriteThroughput))
+		if c := snapshot.Connections; c != nil {
+			writer.WriteString(fmt.Sprintf(",\n%s\"Connections\": {\n", tab1))
+			writer.WriteString(fmt.Sprintf("%s\"Opened\": %d,\n", tab2, c.Opened))
+			writer.WriteString(fmt.Sprintf("%s\"Closed\": %d,\n", tab2, c.Closed))
+			writer.WriteString(fmt.Sprintf("%s\"Reused\": %d,\n", tab2, c.Reused))
+			writer.WriteString(fmt.Sprintf("%s\"Failed\": %d\n", tab2, c.Failed))
+			writer.WriteString(tab1 + "}")
+		}
+		writer.WriteString("\n")
 	}
 	writer.WriteString(tab0 + "}")
 }
@@ -459,17 +700,51 @@ func (p *Printer) buildSummary(snapshot *SnapshotReport, isFinal bool) [][]strin
 
 	codes := sortMapStrInt(snapshot.Codes)
 	for _, v := range codes {
-		if v[0] != "2xx" {
+		if v[0] != "2xx" && v[0] != grpcCodeName(grpcCodeOffset) {
 			v[1] = colorize(v[1], FgMagentaColor)
 		}
 		summarybulk = append(summarybulk, []string{"  " + v[0], v[1]})
 	}
+	if len(snapshot.Redirects) > 0 {
+		// the hops before the responses counted above
+		var hops int64
+		for _, v := range snapshot.Redirects {
+			hops += v
+		}
+		summarybulk = append(summarybulk, []string{"Redirects", strconv.FormatInt(hops, 10)})
+		for _, v := range sortMapStrInt(snapshot.Redirects) {
+			summarybulk = append(summarybulk, []string{"  " + v[0], v[1]})
+		}
+	}
+	if p.openModel {
+		dropped, late := strconv.FormatInt(snapshot.Dropped, 10), strconv.FormatInt(snapshot.Late, 10)
+		if snapshot.Dropped > 0 {
+			dropped = colorize(dropped, FgMagentaColor)
+		}
+		if snapshot.Late > 0 {
+			late = colorize(late, FgMagentaColor)
+		}
+		summarybulk = append(summarybulk, []string{"Dropped", dropped}, []string{"Late", late})
+	}
 	summarybulk = append(summarybulk,
 		[]string{"RPS", fmt.Sprintf("%.3f", snapshot.RPS)},
 		[]string{"Concurrency", fmt.Sprintf("%d", snapshot.concurrencyCount)},
 		[]string{"Reads", fmt.Sprintf("%.3fMB/s", snapshot.ReadThroughput)},
 		[]string{"Writes", fmt.Sprintf("%.3fMB/s", snapshot.WriteThroughput)},
 	)
+	if c := snapshot.Connections; c != nil {
+		failed := strconv.FormatInt(c.Failed, 10)
+		if c.Failed > 0 {
+			failed = colorize(failed, FgMagentaColor)
+		}
+		summarybulk = append(summarybulk,
+			[]string{"Connections", ""},
+			[]string{"  opened", strconv.FormatInt(c.Opened, 10)},
+			[]string{"  closed", strconv.FormatInt(c.Closed, 10)},
+			[]string{"  reused", strconv.FormatInt(c.Reused, 10)},
+			[]string{"  failed", failed},
+		)
+	}
 	alignBulk(summarybulk, AlignLeft, AlignRight)
 	return summarybulk
 }
@@ -138,3 +138,96 @@ func TestAlignBulkPadsColumns(t *testing.T) {
 		t.Fatalf("second column = %q, want right aligned", bulk[0][1])
 	}
 }
+
+func testLabelSnapshot(label string, count int64) *LabelSnapshot {
+	return &LabelSnapshot{
+		Label: label,
+		Count: count,
+		Codes: map[string]int64{"2xx": count - 1, "4xx": 1},
+		RPS:   float64(count),
+		Stats: &struct {
+			Min    time.Duration
+			Mean   time.Duration
+			StdDev time.Duration
+			Max    time.Duration
+		}{time.Millisecond, 2 * time.Millisecond, time.Millisecond, 4 * time.Millisecond},
+		Percentiles: []*struct {
+			Percentile float64
+			Latency    time.Duration
+		}{
+			{0.50, 2 * time.Millisecond},
+			{0.90, 3 * time.Millisecond},
+			{0.99, 4 * time.Millisecond},
+		},
+	}
+}
+
+func TestPrinterFormatsLabels(t *testing.T) {
+	snapshot := testSnapshotReport()
+	snapshot.Labels = []*LabelSnapshot{testLabelSnapshot("GET /a", 2), testLabelSnapshot(`say "hi"`, 5)}
+	printer := NewPrinter(3, 0, false, false)
+
+	var buf bytes.Buffer
+	printer.formatJSONReports(&buf, snapshot, true, false)
+	var got struct {
+		Labels []struct {
+			Label       string            `json:"Label"`
+			Count       int64             `json:"Count"`
+			Counts      map[string]int64  `json:"Counts"`
+			Latency     map[string]string `json:"Latency"`
+			Percentiles map[string]string `json:"Percentiles"`
+		} `json:"Labels"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("formatJSONReports produced invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(got.Labels) != 2 || got.Labels[1].Label != `say "hi"` || got.Labels[1].Count != 5 {
+		t.Fatalf("Labels = %+v, want both labels", got.Labels)
+	}
+	if got.Labels[0].Counts["4xx"] != 1 || got.Labels[0].Latency["Mean"] != "2ms" || got.Labels[0].Percentiles["P99"] != "4ms" {
+		t.Fatalf("Labels[0] = %+v, want codes, latency and percentiles", got.Labels[0])
+	}
+
+	buf.Reset()
+	printer.formatTableReports(&buf, snapshot, true, false)
+	out := buf.String()
+	for _, want := range []string{"Labels:", "GET /a", `say "hi"`, "P90", "2xx:4"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("table output is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrinterNestsTheComparisonInTheJSONReport(t *testing.T) {
+	snapshot := testSnapshotReport()
+	printer := NewPrinter(3, 0, false, false)
+	printer.compare = func(final *SnapshotReport) []*Comparison {
+		return Compare(testSnapshotReport(), final, 0.1, 0.01)
+	}
+
+	var buf bytes.Buffer
+	printer.formatJSONReports(&buf, snapshot, true, false)
+	var got struct {
+		Summary    map[string]any
+		Comparison []struct {
+			Metric    string
+			Regressed bool
+		}
+	}
+	dec := json.NewDecoder(&buf)
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("formatJSONReports produced invalid JSON: %v", err)
+	}
+	if dec.More() {
+		t.Fatal("formatJSONReports produced more than one JSON document")
+	}
+	if got.Summary == nil || len(got.Comparison) == 0 {
+		t.Fatalf("report = %+v, want the summary and the comparison", got)
+	}
+
+	buf.Reset()
+	printer.formatJSONReports(&buf, snapshot, false, false)
+	if strings.Contains(buf.String(), "Comparison") {
+		t.Fatal("an interval report has the comparison, want it in the final one only")
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var pushSchemes = []string{"statsd", "influx+udp", "influx+http", "influx+https", "otlp+http", "otlp+https"}
+
+// maxPushPacket keeps the UDP datagrams of statsd and influx within the
+// usual MTU.
+const maxPushPacket = 1432
+
+const pushTimeout = 5 * time.Second
+
+// IntervalReport aggregates the requests of one --push-interval.
+type IntervalReport struct {
+	Start       time.Time
+	Time        time.Time
+	Count       int64
+	Errors      int64
+	Codes       map[string]int64
+	RPS         float64
+	LatencyMin  time.Duration
+	LatencyMean time.Duration
+	LatencyMax  time.Duration
+	Concurrency int
+	ReadBytes   int64
+	WriteBytes  int64
+}
+
+// intervalStats are the counters of StreamReport since the last push.
+type intervalStats struct {
+	start      time.Time
+	latency    Stats
+	codes      map[int]int64
+	errors     int64
+	readBytes  int64
+	writeBytes int64
+}
+
+// TakeInterval returns the aggregates of the requests since the previous
+// call, or since the start for the first one.
+func (s *StreamReport) TakeInterval() *IntervalReport {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	iv := &s.interval
+	if iv.start.IsZero() {
+		iv.start = time.Unix(0, atomic.LoadInt64(&startTimeUnixNano))
+	}
+	ir := &IntervalReport{
+		Start:       iv.start,
+		Time:        now,
+		Count:       iv.latency.count,
+		Errors:      iv.errors,
+		Codes:       make(map[string]int64, len(iv.codes)),
+		LatencyMin:  time.Duration(iv.latency.min),
+		LatencyMean: time.Duration(iv.latency.Mean()),
+		LatencyMax:  time.Duration(iv.latency.max),
+		Concurrency: s.concurrencyCount,
+		ReadBytes:   s.readBytes - iv.readBytes,
+		WriteBytes:  s.writeBytes - iv.writeBytes,
+	}
+	if elapsed := now.Sub(iv.start).Seconds(); elapsed > 0 {
+		ir.RPS = float64(ir.Count) / elapsed
+	}
+	for code, n := range iv.codes {
+		ir.Codes[statusName(code)] = n
+	}
+	*iv = intervalStats{start: now, readBytes: s.readBytes, writeBytes: s.writeBytes}
+	return ir
+}
+
+func (iv *intervalStats) insert(r *ReportRecord) {
+	iv.latency.Update(float64(r.cost))
+	if r.code != 0 {
+		if iv.codes == nil {
+			iv.codes = make(map[int]int64, 1)
+		}
+		iv.codes[r.code]++
+	}
+	if r.error != "" {
+		iv.errors++
+	}
+}
+
+// pushTag is a run_id or --push-tag tag of every pushed metric.
+type pushTag struct {
+	key, value string
+}
+
+// ParsePushTags returns the tags of the pushed metrics, run_id followed by
+// the K=V tags sorted by key.
+func ParsePushTags(runID string, tags []string) ([]pushTag, error) {
+	var res []pushTag
+	for _, t := range tags {
+		i := strings.IndexByte(t, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid push tag %q, example: env=staging", t)
+		}
+		res = append(res, pushTag{t[:i], t[i+1:]})
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].key < res[j].key })
+	return append([]pushTag{{"run_id", runID}}, res...), nil
+}
+
+// NewRunID returns a random id telling the pushes of a run apart.
+func NewRunID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type pushSink interface {
+	push(ir *IntervalReport, tags []pushTag) error
+}
+
+// Pusher pushes the IntervalReport of a StreamReport to every --push sink
+// each interval, and once more when the report is done.
+type Pusher struct {
+	urls     []string
+	sinks    []pushSink
+	tags     []pushTag
+	interval time.Duration
+
+	failures map[string]int
+	lastErr  map[string]error
+	done     chan struct{}
+}
+
+func NewPusher(urls, headers []string, tags []pushTag, interval time.Duration) (*Pusher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid push interval %s", interval)
+	}
+	p := &Pusher{
+		urls:     urls,
+		tags:     tags,
+		interval: interval,
+		failures: make(map[string]int),
+		lastErr:  make(map[string]error),
+		done:     make(chan struct{}),
+	}
+	for _, u := range urls {
+		sink, err := NewPushSink(u, headers)
+		if err != nil {
+			return nil, err
+		}
+		p.sinks = append(p.sinks, sink)
+	}
+	return p, nil
+}
+
+func (p *Pusher) pushAll(ir *IntervalReport) {
+	for i, sink := range p.sinks {
+		if err := sink.push(ir, p.tags); err != nil {
+			p.failures[p.urls[i]]++
+			p.lastErr[p.urls[i]] = err
+		}
+	}
+}
+
+// Run pushes the intervals of report until doneChan is closed.
+func (p *Pusher) Run(report *StreamReport, doneChan <-chan struct{}) {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.pushAll(report.TakeInterval())
+		case <-doneChan:
+			p.pushAll(report.TakeInterval())
+			return
+		}
+	}
+}
+
+// Wait waits for the last push and returns the failures of each sink.
+func (p *Pusher) Wait() []error {
+	<-p.done
+	var errs []error
+	for _, u := range p.urls {
+		if n := p.failures[u]; n > 0 {
+			errs = append(errs, fmt.Errorf("push to %s failed %d time(s): %v", u, n, p.lastErr[u]))
+		}
+	}
+	return errs
+}
+
+// NewPushSink returns the sink of a --push URL, the scheme picks the
+// protocol: statsd://HOST:PORT, influx+udp://HOST:PORT,
+// influx+http(s)://HOST:PORT/WRITE-PATH or otlp+http(s)://HOST:PORT[/PATH].
+func NewPushSink(rawURL string, headers []string) (pushSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid push url %q: %v", rawURL, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid push url %q: no host", rawURL)
+	}
+	switch u.Scheme {
+	case "statsd", "influx+udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "statsd" {
+			return &udpSink{conn: conn, format: formatStatsD}, nil
+		}
+		return &udpSink{conn: conn, format: formatInfluxLines}, nil
+	case "influx+http", "influx+https", "otlp+http", "otlp+https":
+		kind, scheme, _ := strings.Cut(u.Scheme, "+")
+		u.Scheme = scheme
+		s := &httpSink{url: u.String(), client: &fasthttp.Client{}}
+		for _, h := range headers {
+			k, v, ok := strings.Cut(h, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid push header %q, example: 'Authorization: Token XYZ'", h)
+			}
+			s.headers = append(s.headers, [2]string{strings.TrimSpace(k), strings.TrimSpace(v)})
+		}
+		if kind == "influx" {
+			s.contentType = "text/plain; charset=utf-8"
+			s.format = func(ir *IntervalReport, tags []pushTag) []byte {
+				return bytes.Join(formatInfluxLines(ir, tags), nil)
+			}
+		} else {
+			if u.Path == "" {
+				u.Path = "/v1/metrics"
+				s.url = u.String()
+			}
+			s.contentType = "application/json"
+			s.format = formatOTLP
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("invalid push url %q: scheme must be one of %s", rawURL, strings.Join(pushSchemes, ", "))
+}
+
+// udpSink sends the lines of format in as few datagrams as fit.
+type udpSink struct {
+	conn   net.Conn
+	format func(ir *IntervalReport, tags []pushTag) [][]byte
+}
+
+func (s *udpSink) push(ir *IntervalReport, tags []pushTag) error {
+	var packet []byte
+	for _, line := range s.format(ir, tags) {
+		if len(packet) > 0 && len(packet)+len(line) > maxPushPacket {
+			if _, err := s.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		_, err := s.conn.Write(packet)
+		return err
+	}
+	return nil
+}
+
+// httpSink posts the body of format.
+type httpSink struct {
+	url         string
+	contentType string
+	headers     [][2]string
+	client      *fasthttp.Client
+	format      func(ir *IntervalReport, tags []pushTag) []byte
+}
+
+func (s *httpSink) push(ir *IntervalReport, tags []pushTag) error {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI(s.url)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType(s.contentType)
+	for _, h := range s.headers {
+		req.Header.Set(h[0], h[1])
+	}
+	req.SetBody(s.format(ir, tags))
+	if err := s.client.DoTimeout(req, resp, pushTimeout); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code < 200 || code >= 300 {
+		return fmt.Errorf("status %d %s", code, bytes.TrimSpace(resp.Body()))
+	}
+	return nil
+}
+
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/1e6, 'f', -1, 64)
+}
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// formatStatsD formats ir as StatsD lines with DogStatsD tags, the counts
+// are counters and the rates, latencies in milliseconds and workers are
+// gauges.
+func formatStatsD(ir *IntervalReport, tags []pushTag) [][]byte {
+	var ts []string
+	for _, t := range tags {
+		ts = append(ts, statsdTagReplacer.Replace(t.key)+":"+statsdTagReplacer.Replace(t.value))
+	}
+	suffix := "|#" + strings.Join(ts, ",")
+	line := func(name, value, typ, extra string) []byte {
+		return []byte("plow." + name + ":" + value + "|" + typ + suffix + extra + "\n")
+	}
+	lines := [][]byte{
+		line("requests", strconv.FormatInt(ir.Count, 10), "c", ""),
+		line("errors", strconv.FormatInt(ir.Errors, 10), "c", ""),
+	}
+	for _, code := range sortedKeys(ir.Codes) {
+		lines = append(lines, line("responses", strconv.FormatInt(ir.Codes[code], 10), "c", ",code:"+statsdTagReplacer.Replace(code)))
+	}
+	lines = append(lines,
+		line("rps", strconv.FormatFloat(ir.RPS, 'f', 3, 64), "g", ""),
+	)
+	if ir.Count > 0 {
+		lines = append(lines,
+			line("latency.min", formatMillis(ir.LatencyMin), "g", ""),
+			line("latency.mean", formatMillis(ir.LatencyMean), "g", ""),
+			line("latency.max", formatMillis(ir.LatencyMax), "g", ""),
+		)
+	}
+	return append(lines,
+		line("concurrency", strconv.Itoa(ir.Concurrency), "g", ""),
+		line("read_bytes", strconv.FormatInt(ir.ReadBytes, 10), "c", ""),
+		line("write_bytes", strconv.FormatInt(ir.WriteBytes, 10), "c", ""),
+	)
+}
+
+var influxTagReplacer = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// formatInfluxLines formats ir as InfluxDB line protocol, a "plow" point of
+// the interval and a "plow_responses" point per status code, the latencies
+// are in milliseconds.
+func formatInfluxLines(ir *IntervalReport, tags []pushTag) [][]byte {
+	var tagSet strings.Builder
+	for _, t := range tags {
+		tagSet.WriteString("," + influxTagReplacer.Replace(t.key) + "=" + influxTagReplacer.Replace(t.value))
+	}
+	ts := " " + strconv.FormatInt(ir.Time.UnixNano(), 10) + "\n"
+	fields := fmt.Sprintf("requests=%di,errors=%di,rps=%s,concurrency=%di,read_bytes=%di,write_bytes=%di",
+		ir.Count, ir.Errors, strconv.FormatFloat(ir.RPS, 'f', 3, 64), ir.Concurrency, ir.ReadBytes, ir.WriteBytes)
+	if ir.Count > 0 {
+		fields += ",latency_min=" + formatMillis(ir.LatencyMin) + ",latency_mean=" + formatMillis(ir.LatencyMean) + ",latency_max=" + formatMillis(ir.LatencyMax)
+	}
+	lines := [][]byte{[]byte("plow" + tagSet.String() + " " + fields + ts)}
+	for _, code := range sortedKeys(ir.Codes) {
+		lines = append(lines, []byte(fmt.Sprintf("plow_responses%s,code=%s requests=%di%s", tagSet.String(), influxTagReplacer.Replace(code), ir.Codes[code], ts)))
+	}
+	return lines
+}
+
+// The OTLP/HTTP JSON encoding of an ExportMetricsServiceRequest, the 64 bit
+// integers are strings as proto3 JSON wants them.
+type (
+	otlpAttribute struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	}
+	otlpDataPoint struct {
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		AsInt             string          `json:"asInt,omitempty"`
+		AsDouble          *float64        `json:"asDouble,omitempty"`
+	}
+	otlpSum struct {
+		DataPoints             []*otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int              `json:"aggregationTemporality"`
+		IsMonotonic            bool             `json:"isMonotonic"`
+	}
+	otlpGauge struct {
+		DataPoints []*otlpDataPoint `json:"dataPoints"`
+	}
+	otlpMetric struct {
+		Name  string     `json:"name"`
+		Unit  string     `json:"unit,omitempty"`
+		Sum   *otlpSum   `json:"sum,omitempty"`
+		Gauge *otlpGauge `json:"gauge,omitempty"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope     `json:"scope"`
+		Metrics []*otlpMetric `json:"metrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource        `json:"resource"`
+		ScopeMetrics []*otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpRequest struct {
+		ResourceMetrics []*otlpResourceMetrics `json:"resourceMetrics"`
+	}
+)
+
+// otlpDeltaTemporality is AGGREGATION_TEMPORALITY_DELTA, every push carries
+// the counts of its interval.
+const otlpDeltaTemporality = 1
+
+func otlpAttributes(tags []pushTag) []otlpAttribute {
+	attrs := make([]otlpAttribute, len(tags))
+	for i, t := range tags {
+		attrs[i].Key = t.key
+		attrs[i].Value.StringValue = t.value
+	}
+	return attrs
+}
+
+// formatOTLP formats ir as an OTLP/HTTP JSON request, the tags are
+// resource attributes next to service.name.
+func formatOTLP(ir *IntervalReport, tags []pushTag) []byte {
+	start := strconv.FormatInt(ir.Start.UnixNano(), 10)
+	now := strconv.FormatInt(ir.Time.UnixNano(), 10)
+	sum := func(name, unit string, points ...*otlpDataPoint) *otlpMetric {
+		for _, p := range points {
+			p.StartTimeUnixNano, p.TimeUnixNano = start, now
+		}
+		return &otlpMetric{Name: name, Unit: unit, Sum: &otlpSum{points, otlpDeltaTemporality, true}}
+	}
+	gauge := func(name, unit string, v float64) *otlpMetric {
+		return &otlpMetric{Name: name, Unit: unit, Gauge: &otlpGauge{[]*otlpDataPoint{{TimeUnixNano: now, AsDouble: &v}}}}
+	}
+	count := func(n int64) *otlpDataPoint {
+		return &otlpDataPoint{AsInt: strconv.FormatInt(n, 10)}
+	}
+
+	var responses []*otlpDataPoint
+	for _, code := range sortedKeys(ir.Codes) {
+		p := count(ir.Codes[code])
+		p.Attributes = otlpAttributes([]pushTag{{"code", code}})
+		responses = append(responses, p)
+	}
+	metrics := []*otlpMetric{
+		sum("plow.requests", "{request}", count(ir.Count)),
+		sum("plow.errors", "{request}", count(ir.Errors)),
+	}
+	if len(responses) > 0 {
+		metrics = append(metrics, sum("plow.responses", "{request}", responses...))
+	}
+	metrics = append(metrics, gauge("plow.rps", "{request}/s", ir.RPS))
+	if ir.Count > 0 {
+		metrics = append(metrics,
+			gauge("plow.latency.min", "ms", float64(ir.LatencyMin)/1e6),
+			gauge("plow.latency.mean", "ms", float64(ir.LatencyMean)/1e6),
+			gauge("plow.latency.max", "ms", float64(ir.LatencyMax)/1e6),
+		)
+	}
+	metrics = append(metrics,
+		gauge("plow.concurrency", "{worker}", float64(ir.Concurrency)),
+		sum("plow.read_bytes", "By", count(ir.ReadBytes)),
+		sum("plow.write_bytes", "By", count(ir.WriteBytes)),
+	)
+
+	req := otlpRequest{ResourceMetrics: []*otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: otlpAttributes(append([]pushTag{{"service.name", "plow"}}, tags...))},
+		ScopeMetrics: []*otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "plow", Version: version},
+			Metrics: metrics,
+		}},
+	}}}
+	b, _ := json.Marshal(&req)
+	return b
+}
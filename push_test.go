@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testInterval = &IntervalReport{
+	Start:       time.Unix(100, 0),
+	Time:        time.Unix(110, 0),
+	Count:       30,
+	Errors:      2,
+	Codes:       map[string]int64{"200": 25, "503": 3},
+	RPS:         3,
+	LatencyMin:  500 * time.Microsecond,
+	LatencyMean: 2 * time.Millisecond,
+	LatencyMax:  40 * time.Millisecond,
+	Concurrency: 4,
+	ReadBytes:   3000,
+	WriteBytes:  1200,
+}
+
+func testPushTags(t *testing.T) []pushTag {
+	t.Helper()
+	tags, err := ParsePushTags("r1", []string{"region=eu west", "env=ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tags
+}
+
+func TestFormatStatsD(t *testing.T) {
+	got := string(joinLines(formatStatsD(testInterval, testPushTags(t))))
+	want := `plow.requests:30|c|#run_id:r1,env:ci,region:eu west
+plow.errors:2|c|#run_id:r1,env:ci,region:eu west
+plow.responses:25|c|#run_id:r1,env:ci,region:eu west,code:200
+plow.responses:3|c|#run_id:r1,env:ci,region:eu west,code:503
+plow.rps:3.000|g|#run_id:r1,env:ci,region:eu west
+plow.latency.min:0.5|g|#run_id:r1,env:ci,region:eu west
+plow.latency.mean:2|g|#run_id:r1,env:ci,region:eu west
+plow.latency.max:40|g|#run_id:r1,env:ci,region:eu west
+plow.concurrency:4|g|#run_id:r1,env:ci,region:eu west
+plow.read_bytes:3000|c|#run_id:r1,env:ci,region:eu west
+plow.write_bytes:1200|c|#run_id:r1,env:ci,region:eu west
+`
+	if got != want {
+		t.Fatalf("statsd =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatInfluxLines(t *testing.T) {
+	got := string(joinLines(formatInfluxLines(testInterval, testPushTags(t))))
+	want := `plow,run_id=r1,env=ci,region=eu\ west requests=30i,errors=2i,rps=3.000,concurrency=4i,read_bytes=3000i,write_bytes=1200i,latency_min=0.5,latency_mean=2,latency_max=40 110000000000
+plow_responses,run_id=r1,env=ci,region=eu\ west,code=200 requests=25i 110000000000
+plow_responses,run_id=r1,env=ci,region=eu\ west,code=503 requests=3i 110000000000
+`
+	if got != want {
+		t.Fatalf("influx =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatOTLP(t *testing.T) {
+	var got otlpRequest
+	if err := json.Unmarshal(formatOTLP(testInterval, testPushTags(t)), &got); err != nil {
+		t.Fatal(err)
+	}
+	rm := got.ResourceMetrics[0]
+	if attrs := rm.Resource.Attributes; len(attrs) != 4 || attrs[0].Value.StringValue != "plow" || attrs[1].Key != "run_id" || attrs[3].Value.StringValue != "eu west" {
+		t.Fatalf("resource attributes = %+v, want service.name, run_id and the tags", attrs)
+	}
+	metrics := map[string]*otlpMetric{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	requests := metrics["plow.requests"]
+	if requests == nil || requests.Sum.AggregationTemporality != otlpDeltaTemporality || !requests.Sum.IsMonotonic {
+		t.Fatalf("plow.requests = %+v, want a monotonic delta sum", requests)
+	}
+	p := requests.Sum.DataPoints[0]
+	if p.AsInt != "30" || p.StartTimeUnixNano != "100000000000" || p.TimeUnixNano != "110000000000" {
+		t.Fatalf("plow.requests point = %+v, want 30 over the interval", p)
+	}
+	if r := metrics["plow.responses"].Sum.DataPoints; len(r) != 2 || r[1].Attributes[0].Value.StringValue != "503" || r[1].AsInt != "3" {
+		t.Fatalf("plow.responses = %+v, want a point per code", r)
+	}
+	if m := metrics["plow.latency.max"]; m == nil || m.Unit != "ms" || *m.Gauge.DataPoints[0].AsDouble != 40 {
+		t.Fatalf("plow.latency.max = %+v, want a 40ms gauge", m)
+	}
+}
+
+func joinLines(lines [][]byte) []byte {
+	var b []byte
+	for _, l := range lines {
+		b = append(b, l...)
+	}
+	return b
+}
+
+func TestPusher(t *testing.T) {
+	udp, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	var mu sync.Mutex
+	bodies := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = r.Header.Get("Authorization") + " " + r.Header.Get("Content-Type") + "\n" + string(b)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	urls := []string{"statsd://" + udp.LocalAddr().String(), "influx+http://" + host + "/write", "otlp+http://" + host, "otlp+http://127.0.0.1:1"}
+	pusher, err := NewPusher(urls, []string{"Authorization: Token abc"}, testPushTags(t), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make(chan *ReportRecord, 3)
+	records <- &ReportRecord{cost: time.Millisecond, code: 200}
+	records <- &ReportRecord{cost: 3 * time.Millisecond, code: 200}
+	records <- &ReportRecord{cost: 2 * time.Millisecond, error: "timeout"}
+	close(records)
+	report := NewStreamReport()
+	go pusher.Run(report, report.Done())
+	report.Collect(records)
+	errs := pusher.Wait()
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "otlp+http://127.0.0.1:1 failed 1 time(s)") {
+		t.Fatalf("errors = %v, want the unreachable otlp endpoint only", errs)
+	}
+	buf := make([]byte, maxPushPacket)
+	_ = udp.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := udp.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buf[:n]), "plow.requests:3|c|#run_id:r1,env:ci,region:eu west\nplow.errors:1|c|") {
+		t.Fatalf("statsd packet = %q, want the final interval", buf[:n])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if b := bodies["/write"]; !strings.HasPrefix(b, "Token abc text/plain; charset=utf-8\nplow,run_id=r1,env=ci,region=eu\\ west requests=3i,errors=1i,") {
+		t.Fatalf("influx body = %q", b)
+	}
+	if b := bodies["/v1/metrics"]; !strings.HasPrefix(b, "Token abc application/json\n{\"resourceMetrics\":") {
+		t.Fatalf("otlp body = %q", b)
+	}
+}
+
+func TestPushSinkErrors(t *testing.T) {
+	for _, u := range []string{"kafka://127.0.0.1:9092", "statsd://", "influx+http://127.0.0.1:8086/write"} {
+		headers := []string{"Authorization"}
+		if _, err := NewPushSink(u, headers); err == nil {
+			t.Fatalf("NewPushSink(%q) accepted a bad url or header", u)
+		}
+	}
+	if _, err := ParsePushTags("r1", []string{"=x"}); err == nil {
+		t.Fatal("ParsePushTags accepted a tag without key")
+	}
+	if _, err := NewPusher(nil, nil, nil, 0); err == nil {
+		t.Fatal("NewPusher accepted a zero interval")
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var rawFormats = []string{"csv", "binary"}
+
+// rawMagic starts the binary logs, the csv ones start with rawCSVHeader.
+const rawMagic = "PLOWRAW1"
+
+// The flags of a binary record.
+const (
+	rawLabelOnly = 1 << iota
+	rawShed
+	rawTimed
+	rawOpened
+)
+
+var rawCSVHeader = []string{"start", "latency", "code", "bytes", "error", "worker", "label", "label_only", "redirects", "read_bytes", "write_bytes",
+	"conns_opened", "conns_closed", "conns_reused", "conns_failed", "dropped", "late", "shed", "opened", "phases"}
+
+// rawRecord is the part of a ReportRecord kept by --raw-out, the times are
+// in nanoseconds and the bytes, connections, dropped and late requests are
+// the totals of the run.
+type rawRecord struct {
+	start      int64
+	latency    int64
+	code       int
+	bytes      int64
+	error      string
+	worker     int
+	label      string
+	labelOnly  bool
+	redirects  []int
+	readBytes  int64
+	writeBytes int64
+	conns      connCounts
+	dropped    int64
+	late       int64
+	shed       bool
+	timed      bool
+	opened     bool
+	phases     [phaseCount]int64
+}
+
+func newRawRecord(rr *ReportRecord) rawRecord {
+	raw := rawRecord{
+		start:      rr.start.UnixNano(),
+		latency:    int64(rr.cost),
+		code:       rr.code,
+		bytes:      rr.bytes,
+		error:      rr.error,
+		worker:     rr.worker,
+		label:      rr.label,
+		labelOnly:  rr.labelOnly,
+		readBytes:  rr.readBytes,
+		writeBytes: rr.writeBytes,
+		conns:      rr.conns,
+		dropped:    rr.dropped,
+		late:       rr.late,
+		shed:       rr.shed,
+		timed:      rr.timed,
+	}
+	if len(rr.redirects) > 0 {
+		raw.redirects = append([]int(nil), rr.redirects...)
+	}
+	if rr.timed {
+		raw.opened = rr.opened
+		for i, d := range rr.phases {
+			raw.phases[i] = int64(d)
+		}
+	}
+	return raw
+}
+
+func (raw *rawRecord) record() *ReportRecord {
+	rr := &ReportRecord{
+		start:      time.Unix(0, raw.start),
+		cost:       time.Duration(raw.latency),
+		code:       raw.code,
+		bytes:      raw.bytes,
+		error:      raw.error,
+		worker:     raw.worker,
+		label:      raw.label,
+		labelOnly:  raw.labelOnly,
+		redirects:  raw.redirects,
+		readBytes:  raw.readBytes,
+		writeBytes: raw.writeBytes,
+		conns:      raw.conns,
+		dropped:    raw.dropped,
+		late:       raw.late,
+		shed:       raw.shed,
+		timed:      raw.timed,
+		opened:     raw.opened,
+	}
+	for i, d := range raw.phases {
+		rr.phases[i] = time.Duration(d)
+	}
+	return rr
+}
+
+// totals are the counters of the run besides the bytes.
+func (raw *rawRecord) totals() [6]int64 {
+	return [6]int64{raw.conns.opened, raw.conns.closed, raw.conns.reused, raw.conns.failed, raw.dropped, raw.late}
+}
+
+func (raw *rawRecord) setTotals(t [6]int64) {
+	raw.conns = connCounts{opened: t[0], closed: t[1], reused: t[2], failed: t[3]}
+	raw.dropped, raw.late = t[4], t[5]
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+type rawEncoder interface {
+	encode(raw *rawRecord) error
+	flush() error
+}
+
+type rawCSVEncoder struct {
+	w *csv.Writer
+}
+
+func (e *rawCSVEncoder) encode(raw *rawRecord) error {
+	redirects := make([]string, len(raw.redirects))
+	for i, code := range raw.redirects {
+		redirects[i] = strconv.Itoa(code)
+	}
+	// the phases are left empty without --timings
+	var phases []string
+	if raw.timed {
+		for _, d := range raw.phases {
+			phases = append(phases, strconv.FormatInt(d, 10))
+		}
+	}
+	return e.w.Write([]string{
+		strconv.FormatInt(raw.start, 10),
+		strconv.FormatInt(raw.latency, 10),
+		strconv.Itoa(raw.code),
+		strconv.FormatInt(raw.bytes, 10),
+		raw.error,
+		strconv.Itoa(raw.worker),
+		raw.label,
+		formatBool(raw.labelOnly),
+		strings.Join(redirects, ";"),
+		strconv.FormatInt(raw.readBytes, 10),
+		strconv.FormatInt(raw.writeBytes, 10),
+		strconv.FormatInt(raw.conns.opened, 10),
+		strconv.FormatInt(raw.conns.closed, 10),
+		strconv.FormatInt(raw.conns.reused, 10),
+		strconv.FormatInt(raw.conns.failed, 10),
+		strconv.FormatInt(raw.dropped, 10),
+		strconv.FormatInt(raw.late, 10),
+		formatBool(raw.shed),
+		formatBool(raw.opened),
+		strings.Join(phases, ";"),
+	})
+}
+
+func (e *rawCSVEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// rawBinaryEncoder writes varints, the start and the totals as deltas from
+// the previous record, and the labels and errors once, then by their index.
+// The phases follow the totals with --timings.
+type rawBinaryEncoder struct {
+	w       *bufio.Writer
+	buf     []byte
+	strings map[string]uint64
+	prev    rawRecord
+}
+
+func (e *rawBinaryEncoder) putString(s string) {
+	if s == "" {
+		e.buf = binary.AppendUvarint(e.buf, 0)
+		return
+	}
+	if id, ok := e.strings[s]; ok {
+		e.buf = binary.AppendUvarint(e.buf, id)
+		return
+	}
+	id := uint64(len(e.strings)) + 1
+	e.strings[s] = id
+	e.buf = binary.AppendUvarint(e.buf, id)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *rawBinaryEncoder) encode(raw *rawRecord) error {
+	e.buf = binary.AppendVarint(e.buf[:0], raw.start-e.prev.start)
+	e.buf = binary.AppendVarint(e.buf, raw.latency)
+	e.buf = binary.AppendVarint(e.buf, int64(raw.code))
+	e.buf = binary.AppendVarint(e.buf, raw.bytes)
+	e.buf = binary.AppendVarint(e.buf, int64(raw.worker))
+	e.putString(raw.label)
+	e.putString(raw.error)
+	var flags byte
+	if raw.labelOnly {
+		flags |= rawLabelOnly
+	}
+	if raw.shed {
+		flags |= rawShed
+	}
+	if raw.timed {
+		flags |= rawTimed
+	}
+	if raw.opened {
+		flags |= rawOpened
+	}
+	e.buf = append(e.buf, flags)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(raw.redirects)))
+	for _, code := range raw.redirects {
+		e.buf = binary.AppendVarint(e.buf, int64(code))
+	}
+	e.buf = binary.AppendVarint(e.buf, raw.readBytes-e.prev.readBytes)
+	e.buf = binary.AppendVarint(e.buf, raw.writeBytes-e.prev.writeBytes)
+	prev := e.prev.totals()
+	for i, v := range raw.totals() {
+		e.buf = binary.AppendVarint(e.buf, v-prev[i])
+	}
+	if raw.timed {
+		for _, d := range raw.phases {
+			e.buf = binary.AppendVarint(e.buf, d)
+		}
+	}
+	e.prev = *raw
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+func (e *rawBinaryEncoder) flush() error {
+	return nil
+}
+
+// RawWriter writes every record of --raw-out from its own goroutine, so that
+// the disk doesn't hold up StreamReport.Collect.
+type RawWriter struct {
+	file    *os.File
+	w       *bufio.Writer
+	enc     rawEncoder
+	records chan rawRecord
+	done    chan struct{}
+	err     error
+}
+
+func NewRawWriter(path, format string) (*RawWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &RawWriter{
+		file:    file,
+		w:       bufio.NewWriterSize(file, 1<<20),
+		records: make(chan rawRecord, 1<<16),
+		done:    make(chan struct{}),
+	}
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w.w)
+		_ = cw.Write(rawCSVHeader)
+		w.enc = &rawCSVEncoder{w: cw}
+	case "binary":
+		_, _ = w.w.WriteString(rawMagic)
+		w.enc = &rawBinaryEncoder{w: w.w, strings: make(map[string]uint64)}
+	default:
+		_ = file.Close()
+		return nil, fmt.Errorf("unknown raw format %q", format)
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *RawWriter) run() {
+	defer close(w.done)
+	for raw := range w.records {
+		if w.err == nil {
+			w.err = w.enc.encode(&raw)
+		}
+	}
+}
+
+// Write queues rr, which can be recycled once it returns.
+func (w *RawWriter) Write(rr *ReportRecord) {
+	w.records <- newRawRecord(rr)
+}
+
+// Close writes the queued records and closes the file.
+func (w *RawWriter) Close() error {
+	close(w.records)
+	<-w.done
+	err := w.err
+	if err == nil {
+		err = w.enc.flush()
+	}
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readRawLog calls fn with every record of a --raw-out log in either format.
+func readRawLog(r io.Reader, fn func(*rawRecord)) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	magic, _ := br.Peek(len(rawMagic))
+	if string(magic) == rawMagic {
+		_, _ = br.Discard(len(rawMagic))
+		return readRawBinary(br, fn)
+	}
+	return readRawCSV(br, fn)
+}
+
+func readRawCSV(r io.Reader, fn func(*rawRecord)) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(rawCSVHeader)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil || strings.Join(header, ",") != strings.Join(rawCSVHeader, ",") {
+		return errors.New("not a --raw-out log")
+	}
+	for n := 1; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var raw rawRecord
+		ints := make([]int64, 0, 13)
+		for _, i := range []int{0, 1, 2, 3, 5, 9, 10, 11, 12, 13, 14, 15, 16} {
+			v, err := strconv.ParseInt(row[i], 10, 64)
+			if err != nil {
+				return fmt.Errorf("record %d: invalid %s %q", n, rawCSVHeader[i], row[i])
+			}
+			ints = append(ints, v)
+		}
+		raw.start, raw.latency, raw.code, raw.bytes = ints[0], ints[1], int(ints[2]), ints[3]
+		raw.worker, raw.readBytes, raw.writeBytes = int(ints[4]), ints[5], ints[6]
+		raw.setTotals([6]int64(ints[7:]))
+		raw.error, raw.label, raw.labelOnly = row[4], row[6], row[7] == "1"
+		raw.shed, raw.opened = row[17] == "1", row[18] == "1"
+		if row[19] != "" {
+			phases := strings.Split(row[19], ";")
+			if len(phases) != phaseCount {
+				return fmt.Errorf("record %d: invalid phases %q", n, row[19])
+			}
+			for i, d := range phases {
+				v, err := strconv.ParseInt(d, 10, 64)
+				if err != nil {
+					return fmt.Errorf("record %d: invalid phases %q", n, row[19])
+				}
+				raw.phases[i] = v
+			}
+			raw.timed = true
+		}
+		if row[8] != "" {
+			for _, code := range strings.Split(row[8], ";") {
+				v, err := strconv.Atoi(code)
+				if err != nil {
+					return fmt.Errorf("record %d: invalid redirects %q", n, row[8])
+				}
+				raw.redirects = append(raw.redirects, v)
+			}
+		}
+		fn(&raw)
+	}
+}
+
+func readRawBinary(br *bufio.Reader, fn func(*rawRecord)) error {
+	var table []string
+	var prev rawRecord
+	readString := func() (string, error) {
+		id, err := binary.ReadUvarint(br)
+		if err != nil || id == 0 {
+			return "", err
+		}
+		if id <= uint64(len(table)) {
+			return table[id-1], nil
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return "", err
+		}
+		if id != uint64(len(table))+1 || n > 1<<20 {
+			return "", errors.New("corrupted string table")
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return "", err
+		}
+		table = append(table, string(b))
+		return table[id-1], nil
+	}
+
+	for n := 1; ; n++ {
+		if _, err := br.Peek(1); err == io.EOF {
+			return nil
+		}
+		var raw rawRecord
+		var ints [5]int64
+		var err error
+		for i := range ints {
+			if ints[i], err = binary.ReadVarint(br); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			raw.label, err = readString()
+		}
+		if err == nil {
+			raw.error, err = readString()
+		}
+		var flags byte
+		if err == nil {
+			flags, err = br.ReadByte()
+		}
+		var count uint64
+		if err == nil {
+			count, err = binary.ReadUvarint(br)
+		}
+		for i := uint64(0); err == nil && i < count; i++ {
+			var code int64
+			if code, err = binary.ReadVarint(br); err == nil {
+				raw.redirects = append(raw.redirects, int(code))
+			}
+		}
+		var read, write int64
+		if err == nil {
+			read, err = binary.ReadVarint(br)
+		}
+		if err == nil {
+			write, err = binary.ReadVarint(br)
+		}
+		totals := prev.totals()
+		for i := range totals {
+			var delta int64
+			if err == nil {
+				delta, err = binary.ReadVarint(br)
+			}
+			totals[i] += delta
+		}
+		if flags&rawTimed != 0 {
+			for i := range raw.phases {
+				if err == nil {
+					raw.phases[i], err = binary.ReadVarint(br)
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		raw.start = prev.start + ints[0]
+		raw.latency, raw.code, raw.bytes, raw.worker = ints[1], int(ints[2]), ints[3], int(ints[4])
+		raw.labelOnly, raw.shed = flags&rawLabelOnly != 0, flags&rawShed != 0
+		raw.timed, raw.opened = flags&rawTimed != 0, flags&rawOpened != 0
+		raw.readBytes, raw.writeBytes = prev.readBytes+read, prev.writeBytes+write
+		raw.setTotals(totals)
+		prev = raw
+		fn(&raw)
+	}
+}
+
+// AnalyzeRawLog rebuilds the report of a --raw-out log, it spans from the
+// first start to the last end of its records.
+func AnalyzeRawLog(path string) (*StreamReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	report := NewStreamReport()
+	report.offline = true
+	records := make(chan *ReportRecord, 1024)
+	go report.Collect(records)
+
+	var first, last int64
+	var ends []int64
+	workers := map[int]bool{}
+	err = readRawLog(file, func(raw *rawRecord) {
+		if first == 0 || raw.start < first {
+			first = raw.start
+		}
+		end := raw.start + raw.latency
+		if end > last {
+			last = end
+		}
+		if !raw.labelOnly && !raw.shed {
+			ends = append(ends, end)
+		}
+		// no worker sent the arrivals dropped by --open-model
+		if !raw.shed {
+			workers[raw.worker] = true
+		}
+		rr := raw.record()
+		rr.concurrencyCount = len(workers)
+		records <- rr
+	})
+	close(records)
+	<-report.Done()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	atomic.StoreInt64(&startTimeUnixNano, first)
+	report.lock.Lock()
+	defer report.lock.Unlock()
+	report.end = time.Unix(0, last)
+	// the requests per second of every whole second, like the live report
+	seconds := make([]int64, (last-first)/int64(time.Second))
+	for _, end := range ends {
+		if i := (end - first) / int64(time.Second); i < int64(len(seconds)) {
+			seconds[i]++
+		}
+	}
+	for _, n := range seconds {
+		if n > 0 {
+			report.rpsStats.Update(float64(n))
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var testRawRecords = []*ReportRecord{
+	{start: time.Unix(100, 0), cost: 3 * time.Millisecond, code: 200, bytes: 12, worker: 2, label: "GET /a", readBytes: 100, writeBytes: 40,
+		conns: connCounts{opened: 1}, timed: true, opened: true, phases: [phaseCount]time.Duration{1e6, 2e6, 3e6, 4e6, 5e6}},
+	{start: time.Unix(100, 5e8), cost: 7 * time.Millisecond, code: 302, worker: 1, label: "GET /a", redirects: []int{301, 302}, readBytes: 180, writeBytes: 90,
+		conns: connCounts{opened: 2, reused: 1}, late: 1, timed: true, phases: [phaseCount]time.Duration{phaseTTFB: 6e6, phaseTransfer: 1e6}},
+	{start: time.Unix(101, 0), cost: time.Second, error: "read: \"timeout\",\nagain", worker: 1, readBytes: 180, writeBytes: 130,
+		conns: connCounts{opened: 2, closed: 1, reused: 1, failed: 1}, late: 1},
+	{start: time.Unix(100, 0), cost: 1500 * time.Millisecond, code: 200, worker: 2, label: "journey", labelOnly: true, readBytes: 170, writeBytes: 120,
+		conns: connCounts{opened: 2, closed: 1, reused: 1, failed: 1}, late: 1},
+	{start: time.Unix(101, 2e8), shed: true, readBytes: 180, writeBytes: 130, conns: connCounts{opened: 2, closed: 1, reused: 1, failed: 1}, dropped: 1, late: 1},
+}
+
+func writeRawLog(t *testing.T, format string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "raw."+format)
+	w, err := NewRawWriter(path, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rr := range testRawRecords {
+		w.Write(rr)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRawLogRoundTrip(t *testing.T) {
+	for _, format := range rawFormats {
+		file, err := os.Open(writeRawLog(t, format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []rawRecord
+		err = readRawLog(file, func(raw *rawRecord) { got = append(got, *raw) })
+		_ = file.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(got) != len(testRawRecords) {
+			t.Fatalf("%s: read %d records, want %d", format, len(got), len(testRawRecords))
+		}
+		for i, rr := range testRawRecords {
+			if want := newRawRecord(rr); !reflect.DeepEqual(got[i], want) {
+				t.Fatalf("%s: record #%d = %+v, want %+v", format, i, got[i], want)
+			}
+		}
+	}
+
+	if _, err := NewRawWriter(filepath.Join(t.TempDir(), "raw"), "parquet"); err == nil {
+		t.Fatal("NewRawWriter accepted an unknown format")
+	}
+	if _, err := AnalyzeRawLog(writeDataFile(t, "raw.csv", "url,latency\n")); err == nil {
+		t.Fatal("AnalyzeRawLog accepted a csv file that isn't a log")
+	}
+}
+
+func TestAnalyzeRawLog(t *testing.T) {
+	for _, format := range rawFormats {
+		t.Run(format, func(t *testing.T) { testAnalyzeRawLog(t, format) })
+	}
+}
+
+func testAnalyzeRawLog(t *testing.T, format string) {
+	report, err := AnalyzeRawLog(writeRawLog(t, format))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := report.Snapshot()
+	if snapshot.Count != 3 || snapshot.Elapsed != 2*time.Second {
+		t.Fatalf("count %d elapsed %s, want 3 requests from the first start to the last end", snapshot.Count, snapshot.Elapsed)
+	}
+	if snapshot.StatusCodes["200"] != 1 || snapshot.StatusCodes["302"] != 1 || snapshot.Redirects["301"] != 1 || len(snapshot.Errors) != 1 {
+		t.Fatalf("codes %v redirects %v errors %v", snapshot.StatusCodes, snapshot.Redirects, snapshot.Errors)
+	}
+	if snapshot.Stats.Max != time.Second || snapshot.concurrencyCount != 2 {
+		t.Fatalf("max %s concurrency %d, want 1s and 2 workers", snapshot.Stats.Max, snapshot.concurrencyCount)
+	}
+	if len(snapshot.Labels) != 2 || snapshot.Labels[0].Label != "GET /a" || snapshot.Labels[1].Count != 1 {
+		t.Fatalf("labels = %v, want GET /a and the journey", snapshot.Labels)
+	}
+	if c := snapshot.Connections; c == nil || c.Opened != 2 || c.Closed != 1 || c.Reused != 1 || c.Failed != 1 {
+		t.Fatalf("connections = %+v, want the counts of the last record", c)
+	}
+	if snapshot.Dropped != 1 || snapshot.Late != 1 {
+		t.Fatalf("dropped %d late %d, want 1 and 1", snapshot.Dropped, snapshot.Late)
+	}
+	if len(snapshot.Timings) != phaseCount || snapshot.Timings[phaseDNS].Count != 1 || snapshot.Timings[phaseTTFB].Count != 2 {
+		t.Fatalf("timings = %v, want the phases of the timed requests", snapshot.Timings)
+	}
+}
+
+func TestRawOutRecordsTheRequests(t *testing.T) {
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("hello")
+	})
+
+	requester, err := NewRequester(2, 6, 0, nil, io.Discard, &ClientOpt{
+		url:         "http://" + addr + "/",
+		method:      fasthttp.MethodGet,
+		maxConns:    2,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "raw.csv")
+	report := NewStreamReport()
+	if report.raw, err = NewRawWriter(path, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	go requester.Run()
+	report.Collect(requester.RecordChan())
+	if err := report.raw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	workers := map[int]int{}
+	err = readRawLog(file, func(raw *rawRecord) {
+		if raw.code != fasthttp.StatusOK || raw.bytes != 5 || raw.start < before.UnixNano() || raw.latency <= 0 {
+			t.Fatalf("record = %+v, want a timed 200 of 5 bytes", raw)
+		}
+		workers[raw.worker]++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workers[1]+workers[2] != 6 {
+		t.Fatalf("workers = %v, want the 6 requests sent by workers 1 and 2", workers)
+	}
+}
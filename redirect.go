@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	url2 "net/url"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+func isRedirect(code int) bool {
+	switch code {
+	case fasthttp.StatusMovedPermanently, fasthttp.StatusFound, fasthttp.StatusSeeOther,
+		fasthttp.StatusTemporaryRedirect, fasthttp.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirector follows the Location headers of --follow-redirects. The hops to
+// the host of the url use the client of the run, the other hosts get their
+// own HTTP/1.1 client.
+type redirector struct {
+	r    *Requester
+	max  int
+	base *url2.URL
+
+	mu      sync.Mutex
+	clients map[string]HTTPClient
+}
+
+func newRedirector(r *Requester, max int) (*redirector, error) {
+	base, err := url2.Parse(r.clientOpt.url)
+	if err != nil {
+		return nil, err
+	}
+	return &redirector{
+		r:       r,
+		max:     max,
+		base:    base,
+		clients: map[string]HTTPClient{hostKey(base): r.httpClient},
+	}, nil
+}
+
+func (rd *redirector) client(u *url2.URL) (HTTPClient, error) {
+	key := hostKey(u)
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	if c, ok := rd.clients[key]; ok {
+		return c, nil
+	}
+	if rd.r.targets != nil {
+		if _, ok := rd.r.targets.byHost[key]; ok {
+			return rd.r.httpClient, nil
+		}
+	}
+	opt := *rd.r.clientOpt
+	opt.url = key
+	c, _, err := buildRequestClient(&opt, &rd.r.readBytes, &rd.r.writeBytes, &rd.r.conns)
+	if err != nil {
+		return nil, err
+	}
+	rd.clients[key] = c
+	return c, nil
+}
+
+// follow sends the redirects of resp until a response that isn't one, resp
+// is left with the last response and rr.redirects with the code of every hop.
+func (rd *redirector) follow(req *fasthttp.Request, resp *fasthttp.Response, rr *ReportRecord, jar *cookieJar) error {
+	if !isRedirect(resp.StatusCode()) || len(resp.Header.Peek(fasthttp.HeaderLocation)) == 0 {
+		return nil
+	}
+	ref, err := url2.Parse(string(req.URI().RequestURI()))
+	if err != nil {
+		return err
+	}
+	origin := rd.base
+	if rd.r.targets != nil {
+		// the target the request was sent to
+		origin = &url2.URL{Scheme: string(req.URI().Scheme()), Host: string(req.URI().Host())}
+	}
+	cur := origin.ResolveReference(ref)
+
+	hop := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(hop)
+	req.CopyTo(hop)
+	hop.UseHostHeader = true
+	for isRedirect(resp.StatusCode()) {
+		location := resp.Header.Peek(fasthttp.HeaderLocation)
+		if len(location) == 0 {
+			return nil
+		}
+		if len(rr.redirects) == rd.max {
+			return fmt.Errorf("stopped after %d redirects", rd.max)
+		}
+		code := resp.StatusCode()
+		rr.redirects = append(rr.redirects, code)
+
+		ref, err := url2.Parse(string(location))
+		if err != nil {
+			return fmt.Errorf("invalid redirect location %q", location)
+		}
+		next := cur.ResolveReference(ref)
+		if next.Scheme != "http" && next.Scheme != "https" {
+			return fmt.Errorf("invalid redirect location %q", location)
+		}
+		client, err := rd.client(next)
+		if err != nil {
+			return err
+		}
+
+		hop.SetRequestURI(next.String())
+		if next.Host == origin.Host && rd.r.clientOpt.host != "" {
+			hop.Header.SetHost(rd.r.clientOpt.host)
+		} else {
+			hop.Header.SetHost(next.Host)
+		}
+		method := string(hop.Header.Method())
+		if code == fasthttp.StatusSeeOther && method != fasthttp.MethodHead ||
+			(code == fasthttp.StatusMovedPermanently || code == fasthttp.StatusFound) && method == fasthttp.MethodPost {
+			hop.Header.SetMethod(fasthttp.MethodGet)
+			hop.ResetBody()
+			hop.Header.SetContentLength(0)
+			hop.Header.Del(fasthttp.HeaderContentType)
+		}
+		jar.setCookies(hop)
+		if err := rd.r.send(client, hop, resp); err != nil {
+			return err
+		}
+		jar.storeCookies(hop, resp)
+		cur = next
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func runRedirects(t *testing.T, opt *ClientOpt, requests int64) []*ReportRecord {
+	t.Helper()
+	opt.maxConns = 1
+	opt.dialTimeout = time.Second
+	opt.doTimeout = time.Second
+	requester, err := NewRequester(1, requests, 0, nil, io.Discard, opt, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collectRecords(t, requester)
+}
+
+func TestFollowRedirects(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	cdn := "http://" + startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		got = append(got, string(ctx.Method())+" "+string(ctx.Host())+string(ctx.RequestURI())+" "+string(ctx.PostBody()))
+		mu.Unlock()
+	})
+	url := "http://" + startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		got = append(got, string(ctx.Method())+" "+string(ctx.Host())+string(ctx.RequestURI())+" "+string(ctx.PostBody()))
+		mu.Unlock()
+		switch string(ctx.Path()) {
+		case "/login":
+			ctx.Response.Header.Set("Set-Cookie", "sid=1; Path=/")
+			ctx.Redirect("/home", fasthttp.StatusSeeOther)
+		case "/home":
+			if len(ctx.Request.Header.Cookie("sid")) == 0 {
+				ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+				return
+			}
+			ctx.Redirect(cdn+"/asset?v=1", fasthttp.StatusFound)
+		}
+	})
+
+	records := runRedirects(t, &ClientOpt{
+		url:             url + "/login",
+		method:          fasthttp.MethodPost,
+		bodyBytes:       []byte("user=alice"),
+		cookies:         true,
+		followRedirects: 3,
+	}, 2)
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+	for _, rr := range records {
+		if rr.code != fasthttp.StatusOK || rr.error != "" {
+			t.Fatalf("record = code %d error %q, want 200", rr.code, rr.error)
+		}
+		if len(rr.redirects) != 2 || rr.redirects[0] != fasthttp.StatusSeeOther || rr.redirects[1] != fasthttp.StatusFound {
+			t.Fatalf("redirects = %v, want [303 302]", rr.redirects)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	host := strings.TrimPrefix(url, "http://")
+	want := []string{
+		"POST " + host + "/login user=alice",
+		"GET " + host + "/home ",
+		"GET " + strings.TrimPrefix(cdn, "http://") + "/asset?v=1 ",
+	}
+	if len(got) != 6 || strings.Join(got[:3], "\n") != strings.Join(want, "\n") {
+		t.Fatalf("requests = %q, want %q twice", got, want)
+	}
+}
+
+func TestFollowRedirectsLimit(t *testing.T) {
+	url := "http://" + startServer(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.Redirect("/loop", fasthttp.StatusTemporaryRedirect)
+	})
+
+	records := runRedirects(t, &ClientOpt{url: url, method: fasthttp.MethodGet, followRedirects: 2}, 1)
+	if len(records) != 1 || records[0].error != "stopped after 2 redirects" || len(records[0].redirects) != 2 {
+		t.Fatalf("record = %+v, want the loop to be stopped after 2 redirects", records[0])
+	}
+
+	records = runRedirects(t, &ClientOpt{url: url, method: fasthttp.MethodGet}, 1)
+	if len(records) != 1 || records[0].code != fasthttp.StatusTemporaryRedirect || len(records[0].redirects) != 0 {
+		t.Fatalf("record = %+v, want the redirect without --follow-redirects", records[0])
+	}
+}
+
+func TestStreamReportCountsRedirects(t *testing.T) {
+	records := make(chan *ReportRecord, 2)
+	records <- &ReportRecord{cost: time.Millisecond, code: 200, redirects: []int{301, 302}}
+	records <- &ReportRecord{cost: time.Millisecond, code: 404, redirects: []int{302}}
+	close(records)
+
+	report := NewStreamReport()
+	report.Collect(records)
+	snapshot := report.Snapshot()
+	if snapshot.Codes["2xx"] != 1 || snapshot.Codes["4xx"] != 1 || snapshot.Codes["3xx"] != 0 {
+		t.Fatalf("codes = %v, want only the final statuses", snapshot.Codes)
+	}
+	if len(snapshot.Redirects) != 2 || snapshot.Redirects["301"] != 1 || snapshot.Redirects["302"] != 2 {
+		t.Fatalf("redirects = %v, want 301: 1, 302: 2", snapshot.Redirects)
+	}
+}
+
+func TestFollowRedirectsFromATemplatedURL(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	url := "http://" + startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		got = append(got, string(ctx.RequestURI()))
+		mu.Unlock()
+		if strings.HasSuffix(string(ctx.Path()), "/page") {
+			ctx.Redirect("next", fasthttp.StatusFound)
+		}
+	})
+
+	records := runRedirects(t, &ClientOpt{url: url + "/{{seq}}/page", method: fasthttp.MethodGet, followRedirects: 1}, 2)
+	for _, rr := range records {
+		if rr.code != fasthttp.StatusOK || len(rr.redirects) != 1 {
+			t.Fatalf("record = code %d error %q redirects %v, want one redirect", rr.code, rr.error, rr.redirects)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// the location is resolved against the evaluated url
+	if want := "/1/page,/1/next,/2/page,/2/next"; strings.Join(got, ",") != want {
+		t.Fatalf("requests = %q, want %s", got, want)
+	}
+}
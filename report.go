@@ -2,6 +2,8 @@ package main
 
 import (
 	"math"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -53,7 +55,7 @@ func (s *Stats) Update(v float64) {
 func (s *Stats) Stddev() float64 {
 	num := (float64(s.count) * s.sumSq) - math.Pow(s.sum, 2)
 	div := float64(s.count * (s.count - 1))
-	if div == 0 {
+	if div == 0 || num <= 0 {
 		return 0
 	}
 	return math.Sqrt(num / div)
@@ -74,6 +76,38 @@ func (s *Stats) Reset() {
 	s.max = 0
 }
 
+type labelReport struct {
+	latencyStats     *Stats
+	latencyQuantile  *quantile.Stream
+	codes            map[int]int64
+	latencyWithinSec *Stats
+	latencyTemp      *Stats
+}
+
+func newLabelReport() *labelReport {
+	return &labelReport{
+		latencyStats:     &Stats{},
+		latencyQuantile:  quantile.NewTargeted(quantilesTarget),
+		codes:            make(map[int]int64, 1),
+		latencyWithinSec: &Stats{},
+		latencyTemp:      &Stats{},
+	}
+}
+
+func (l *labelReport) insert(r *ReportRecord) {
+	l.update(r.cost)
+	if r.code != 0 {
+		l.codes[r.code]++
+	}
+}
+
+func (l *labelReport) update(d time.Duration) {
+	v := float64(d)
+	l.latencyStats.Update(v)
+	l.latencyQuantile.Insert(v)
+	l.latencyTemp.Update(v)
+}
+
 type StreamReport struct {
 	lock sync.Mutex
 
@@ -81,9 +115,15 @@ type StreamReport struct {
 	rpsStats         *Stats
 	latencyQuantile  *quantile.Stream
 	latencyHistogram *histogram.Histogram
+	// latencyBuckets counts the latencies by metricsBuckets for /metrics
+	latencyBuckets   []int64
 	codes            map[int]int64
+	redirects        map[int]int64
 	errors           map[string]int64
 	concurrencyCount int
+	labels           map[string]*labelReport
+	// phases of --timings, nil until a timed record comes
+	phases []*labelReport
 
 	latencyWithinSec *Stats
 	rpsWithinSec     float64
@@ -91,6 +131,19 @@ type StreamReport struct {
 
 	readBytes  int64
 	writeBytes int64
+	conns      connCounts
+	dropped    int64
+	late       int64
+
+	// interval counts the requests since the last --push
+	interval intervalStats
+
+	// raw writes every record with --raw-out
+	raw *RawWriter
+	// offline reports are rebuilt from a --raw-out log, they end at the
+	// last record rather than now
+	offline bool
+	end     time.Time
 
 	doneChan chan struct{}
 }
@@ -99,8 +152,11 @@ func NewStreamReport() *StreamReport {
 	return &StreamReport{
 		latencyQuantile:  quantile.NewTargeted(quantilesTarget),
 		latencyHistogram: histogram.New(8),
+		latencyBuckets:   make([]int64, len(metricsBuckets)+1),
 		codes:            make(map[int]int64, 1),
+		redirects:        make(map[int]int64),
 		errors:           make(map[string]int64, 1),
+		labels:           make(map[string]*labelReport),
 		doneChan:         make(chan struct{}, 1),
 		latencyStats:     &Stats{},
 		rpsStats:         &Stats{},
@@ -111,12 +167,16 @@ func NewStreamReport() *StreamReport {
 func (s *StreamReport) insert(v float64) {
 	s.latencyQuantile.Insert(v)
 	s.latencyHistogram.Insert(v)
+	s.latencyBuckets[metricsBucket(v)]++
 	s.latencyStats.Update(v)
 }
 
 func (s *StreamReport) Collect(records <-chan *ReportRecord) {
 	latencyWithinSecTemp := &Stats{}
 	go func() {
+		if s.offline {
+			return
+		}
 		startTime := time.Unix(0, atomic.LoadInt64(&startTimeUnixNano))
 		ticker := time.NewTicker(time.Second)
 		lastCount := int64(0)
@@ -135,6 +195,14 @@ func (s *StreamReport) Collect(records <-chan *ReportRecord) {
 					*s.latencyWithinSec = *latencyWithinSecTemp
 					s.rpsWithinSec = rps
 					latencyWithinSecTemp.Reset()
+					for _, l := range s.labels {
+						*l.latencyWithinSec = *l.latencyTemp
+						l.latencyTemp.Reset()
+					}
+					for _, l := range s.phases {
+						*l.latencyWithinSec = *l.latencyTemp
+						l.latencyTemp.Reset()
+					}
 					s.noDateWithinSec = false
 				} else {
 					s.noDateWithinSec = true
@@ -153,21 +221,65 @@ func (s *StreamReport) Collect(records <-chan *ReportRecord) {
 			break
 		}
 		s.lock.Lock()
-		latencyWithinSecTemp.Update(float64(r.cost))
-		s.insert(float64(r.cost))
-		if r.code != 0 {
-			s.codes[r.code]++
+		if !r.labelOnly && !r.shed {
+			latencyWithinSecTemp.Update(float64(r.cost))
+			s.insert(float64(r.cost))
+			s.interval.insert(r)
+			if r.code != 0 {
+				s.codes[r.code]++
+			}
+			for _, code := range r.redirects {
+				s.redirects[code]++
+			}
+			if r.error != "" {
+				s.errors[r.error]++
+			}
+			if r.timed {
+				s.insertPhases(r)
+			}
 		}
-		if r.error != "" {
-			s.errors[r.error]++
+		if r.label != "" {
+			l, ok := s.labels[r.label]
+			if !ok {
+				l = newLabelReport()
+				s.labels[r.label] = l
+			}
+			l.insert(r)
 		}
 		s.readBytes = r.readBytes
 		s.writeBytes = r.writeBytes
+		s.conns = r.conns
+		s.dropped = r.dropped
+		s.late = r.late
 		s.concurrencyCount = r.concurrencyCount
 		s.lock.Unlock()
+		if s.raw != nil {
+			s.raw.Write(r)
+		}
+		r.bytes = 0
+		r.labelOnly = false
+		r.shed = false
+		r.redirects = r.redirects[:0]
+		r.timed = false
 		recordPool.Put(r)
 	}
 }
+
+func (s *StreamReport) insertPhases(r *ReportRecord) {
+	if s.phases == nil {
+		s.phases = make([]*labelReport, phaseCount)
+		for i := range s.phases {
+			s.phases[i] = newLabelReport()
+		}
+	}
+	for i, d := range r.phases {
+		if isConnPhase(i) && !r.opened {
+			continue
+		}
+		s.phases[i].update(d)
+	}
+}
+
 func (s *StreamReport) copyCodes() map[int]int64 {
 	res := make(map[int]int64, len(s.codes))
 	for k, v := range s.codes {
@@ -180,12 +292,24 @@ type SnapshotReport struct {
 	Elapsed          time.Duration
 	Count            int64
 	Codes            map[string]int64
+	StatusCodes      map[string]int64
+	Redirects        map[string]int64
 	Errors           map[string]int64
 	RPS              float64
 	ReadThroughput   float64
 	WriteThroughput  float64
+	Dropped          int64
+	Late             int64
 	concurrencyCount int
 
+	// Connections of the HTTP/1.1 clients, nil when none was dialed
+	Connections *struct {
+		Opened int64
+		Closed int64
+		Reused int64
+		Failed int64
+	}
+
 	Stats *struct {
 		Min    time.Duration
 		Mean   time.Duration
@@ -209,13 +333,88 @@ type SnapshotReport struct {
 		Mean  time.Duration
 		Count int
 	}
+
+	Labels []*LabelSnapshot
+
+	// Timings are the phases of --timings, labeled by their name.
+	Timings []*LabelSnapshot
+}
+
+type LabelSnapshot struct {
+	Label string
+	Count int64
+	Codes map[string]int64
+	RPS   float64
+
+	Stats *struct {
+		Min    time.Duration
+		Mean   time.Duration
+		StdDev time.Duration
+		Max    time.Duration
+	}
+
+	Percentiles []*struct {
+		Percentile float64
+		Latency    time.Duration
+	}
+}
+
+func statusName(code int) string {
+	if code >= grpcCodeOffset {
+		return grpcCodeName(code)
+	}
+	return strconv.Itoa(code)
+}
+
+func codeSections(codes map[int]int64) map[string]int64 {
+	res := make(map[string]int64, len(codes))
+	for k, v := range codes {
+		if k >= grpcCodeOffset {
+			res[grpcCodeName(k)] += v
+			continue
+		}
+		section := k / 100
+		res[httpStatusSectionLabelMap[section]] += v
+	}
+	return res
+}
+
+func (l *labelReport) snapshot(label string, elapsed time.Duration) *LabelSnapshot {
+	ls := &LabelSnapshot{
+		Label: label,
+		Count: l.latencyStats.count,
+		Codes: codeSections(l.codes),
+		RPS:   float64(l.latencyStats.count) / elapsed.Seconds(),
+		Stats: &struct {
+			Min    time.Duration
+			Mean   time.Duration
+			StdDev time.Duration
+			Max    time.Duration
+		}{time.Duration(l.latencyStats.min), time.Duration(l.latencyStats.Mean()),
+			time.Duration(l.latencyStats.Stddev()), time.Duration(l.latencyStats.max)},
+	}
+	ls.Percentiles = make([]*struct {
+		Percentile float64
+		Latency    time.Duration
+	}, len(quantiles))
+	for i, p := range quantiles {
+		ls.Percentiles[i] = &struct {
+			Percentile float64
+			Latency    time.Duration
+		}{p, time.Duration(l.latencyQuantile.Query(p))}
+	}
+	return ls
 }
 
 func (s *StreamReport) Snapshot() *SnapshotReport {
 	s.lock.Lock()
 	startTime := time.Unix(0, atomic.LoadInt64(&startTimeUnixNano))
+	elapsed := time.Since(startTime)
+	if s.offline {
+		elapsed = s.end.Sub(startTime)
+	}
 	rs := &SnapshotReport{
-		Elapsed: time.Since(startTime),
+		Elapsed: elapsed,
 		Count:   s.latencyStats.count,
 		Stats: &struct {
 			Min    time.Duration
@@ -239,12 +438,28 @@ func (s *StreamReport) Snapshot() *SnapshotReport {
 	rs.RPS = float64(rs.Count) / elapseInSec
 	rs.ReadThroughput = float64(s.readBytes) / 1024.0 / 1024.0 / elapseInSec
 	rs.WriteThroughput = float64(s.writeBytes) / 1024.0 / 1024.0 / elapseInSec
+	if c := s.conns; c.opened+c.failed > 0 {
+		rs.Connections = &struct {
+			Opened int64
+			Closed int64
+			Reused int64
+			Failed int64
+		}{c.opened, c.closed, c.reused, c.failed}
+	}
+	rs.Dropped = s.dropped
+	rs.Late = s.late
 	rs.concurrencyCount = s.concurrencyCount
 
-	rs.Codes = make(map[string]int64, len(s.codes))
+	rs.Codes = codeSections(s.codes)
+	rs.StatusCodes = make(map[string]int64, len(s.codes))
 	for k, v := range s.codes {
-		section := k / 100
-		rs.Codes[httpStatusSectionLabelMap[section]] += v
+		rs.StatusCodes[statusName(k)] = v
+	}
+	if len(s.redirects) > 0 {
+		rs.Redirects = make(map[string]int64, len(s.redirects))
+		for k, v := range s.redirects {
+			rs.Redirects[strconv.Itoa(k)] = v
+		}
 	}
 	rs.Errors = make(map[string]int64, len(s.errors))
 	for k, v := range s.errors {
@@ -274,6 +489,25 @@ func (s *StreamReport) Snapshot() *SnapshotReport {
 		}{time.Duration(b.Mean()), b.Count}
 	}
 
+	if len(s.labels) > 0 {
+		names := make([]string, 0, len(s.labels))
+		for name := range s.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		rs.Labels = make([]*LabelSnapshot, len(names))
+		for i, name := range names {
+			rs.Labels[i] = s.labels[name].snapshot(name, rs.Elapsed)
+		}
+	}
+
+	if s.phases != nil {
+		rs.Timings = make([]*LabelSnapshot, len(s.phases))
+		for i, l := range s.phases {
+			rs.Timings[i] = l.snapshot(phaseNames[i], rs.Elapsed)
+		}
+	}
+
 	s.lock.Unlock()
 	return rs
 }
@@ -283,10 +517,12 @@ func (s *StreamReport) Done() <-chan struct{} {
 }
 
 type ChartsReport struct {
-	RPS         float64
-	Latency     Stats
-	CodeMap     map[int]int64
-	Concurrency int
+	RPS          float64
+	Latency      Stats
+	CodeMap      map[int]int64
+	Concurrency  int
+	LabelLatency map[string]Stats
+	PhaseLatency map[string]Stats
 }
 
 func (s *StreamReport) Charts() *ChartsReport {
@@ -301,6 +537,22 @@ func (s *StreamReport) Charts() *ChartsReport {
 			CodeMap:     s.copyCodes(),
 			Concurrency: s.concurrencyCount,
 		}
+		if len(s.labels) > 0 {
+			cr.LabelLatency = make(map[string]Stats, len(s.labels))
+			for name, l := range s.labels {
+				if l.latencyWithinSec.count > 0 {
+					cr.LabelLatency[name] = *l.latencyWithinSec
+				}
+			}
+		}
+		if s.phases != nil {
+			cr.PhaseLatency = make(map[string]Stats, len(s.phases))
+			for i, l := range s.phases {
+				if l.latencyWithinSec.count > 0 {
+					cr.PhaseLatency[phaseNames[i]] = *l.latencyWithinSec
+				}
+			}
+		}
 	}
 	s.lock.Unlock()
 	return cr
@@ -132,3 +132,51 @@ func TestStreamReportCharts(t *testing.T) {
 		t.Fatalf("Charts() = %+v when noDateWithinSec is true, want nil", got)
 	}
 }
+
+func TestStreamReportBreaksDownByLabel(t *testing.T) {
+	oldStartTime := atomic.LoadInt64(&startTimeUnixNano)
+	t.Cleanup(func() { atomic.StoreInt64(&startTimeUnixNano, oldStartTime) })
+	atomic.StoreInt64(&startTimeUnixNano, time.Now().Add(-time.Second).UnixNano())
+
+	report := NewStreamReport()
+	records := make(chan *ReportRecord, 4)
+	records <- &ReportRecord{cost: 10 * time.Millisecond, code: 200, label: "fast"}
+	records <- &ReportRecord{cost: 20 * time.Millisecond, code: 200, label: "fast"}
+	records <- &ReportRecord{cost: 90 * time.Millisecond, code: 502, label: "slow"}
+	records <- &ReportRecord{cost: 50 * time.Millisecond, code: 200}
+	close(records)
+	report.Collect(records)
+
+	snapshot := report.Snapshot()
+	if snapshot.Count != 4 {
+		t.Fatalf("Count = %d, want 4 including the unlabeled record", snapshot.Count)
+	}
+	if len(snapshot.Labels) != 2 {
+		t.Fatalf("Labels len = %d, want 2", len(snapshot.Labels))
+	}
+	fast, slow := snapshot.Labels[0], snapshot.Labels[1]
+	if fast.Label != "fast" || slow.Label != "slow" {
+		t.Fatalf("labels = %q, %q, want sorted fast, slow", fast.Label, slow.Label)
+	}
+	if fast.Count != 2 || fast.Codes["2xx"] != 2 || fast.Stats.Mean != 15*time.Millisecond {
+		t.Fatalf("fast = count %d codes %v mean %s, want 2 requests of 2xx with mean 15ms", fast.Count, fast.Codes, fast.Stats.Mean)
+	}
+	if slow.Count != 1 || slow.Codes["5xx"] != 1 || slow.Stats.Max != 90*time.Millisecond {
+		t.Fatalf("slow = count %d codes %v max %s, want 1 request of 5xx with max 90ms", slow.Count, slow.Codes, slow.Stats.Max)
+	}
+	if len(fast.Percentiles) != len(quantiles) || fast.Percentiles[len(quantiles)-1].Latency != 20*time.Millisecond {
+		t.Fatalf("fast percentiles = %v, want %d quantiles topping at 20ms", fast.Percentiles, len(quantiles))
+	}
+
+	report.lock.Lock()
+	report.noDateWithinSec = false
+	*report.labels["fast"].latencyWithinSec = *report.labels["fast"].latencyTemp
+	report.lock.Unlock()
+	charts := report.Charts()
+	if got := charts.LabelLatency["fast"]; got.count != 2 {
+		t.Fatalf("LabelLatency[fast] = %+v, want two samples", got)
+	}
+	if _, ok := charts.LabelLatency["slow"]; ok {
+		t.Fatal("LabelLatency contains slow without samples in the last second")
+	}
+}
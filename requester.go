@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -29,12 +30,33 @@ var (
 )
 
 type ReportRecord struct {
+	start            time.Time
 	cost             time.Duration
 	code             int
 	error            string
 	readBytes        int64
 	writeBytes       int64
+	conns            connCounts
 	concurrencyCount int
+	label            string
+	dropped          int64
+	late             int64
+	worker           int
+	// bytes is the size of the response body.
+	bytes int64
+	// labelOnly records only count in the stats of their label, such as
+	// the whole journey of a --scenario.
+	labelOnly bool
+	// shed records stand for an --open-model arrival dropped at
+	// --max-inflight, they only carry the counters.
+	shed bool
+	// redirects are the codes of the hops followed before the response.
+	redirects []int
+	// phases are set with --timings, the connection ones only when the
+	// request opened a connection.
+	timed  bool
+	opened bool
+	phases [phaseCount]time.Duration
 }
 
 var recordPool = sync.Pool{
@@ -56,7 +78,8 @@ func init() {
 
 type MyConn struct {
 	net.Conn
-	r, w *int64
+	r, w  *int64
+	trace *requestTrace
 }
 
 func NewMyConn(conn net.Conn, r, w *int64) (*MyConn, error) {
@@ -69,11 +92,17 @@ func (c *MyConn) Read(b []byte) (n int, err error) {
 
 	if err == nil {
 		atomic.AddInt64(c.r, int64(sz))
+		if c.trace != nil && sz > 0 {
+			c.trace.onRead()
+		}
 	}
 	return sz, err
 }
 
 func (c *MyConn) Write(b []byte) (n int, err error) {
+	if c.trace != nil {
+		c.trace.onWrite()
+	}
 	sz, err := c.Conn.Write(b)
 
 	if err == nil {
@@ -99,8 +128,18 @@ type Requester struct {
 	duration    time.Duration
 	rampUp      int
 	clientOpt   *ClientOpt
-	httpClient  *fasthttp.HostClient
+	httpClient  HTTPClient
 	httpHeader  *fasthttp.RequestHeader
+	isTLS       bool
+	requestSet  *RequestSet
+	targets     *TargetSet
+	ws          *wsClient
+	grpc        *grpcClient
+	templates   *requestTemplates
+	scenario    *Scenario
+	script      *Script
+	fileCookies []fileCookie
+	redirector  *redirector
 	errWriter   io.Writer
 
 	recordChan chan *ReportRecord
@@ -109,6 +148,11 @@ type Requester struct {
 
 	readBytes  int64
 	writeBytes int64
+	conns      connStats
+	dropped    int64
+	late       int64
+
+	concurrencyCount int64
 
 	cancel func()
 }
@@ -120,6 +164,38 @@ type ClientOpt struct {
 	bodyBytes []byte
 	bodyFile  string
 
+	targets      []*Target
+	targetsMode  string
+	requestsFile string
+	scenarioFile string
+	scriptFile   string
+	requestsMode string
+	assertions   *Assertions
+
+	h2           bool
+	h2Conns      int
+	h2MaxStreams int
+	h3           bool
+
+	openModel   bool
+	maxInflight int
+	stages      []Stage
+	rateStages  []Stage
+
+	data *DataSet
+
+	cookies    bool
+	cookieFile string
+
+	followRedirects int
+	timings         bool
+
+	wsMessages []string
+	wsBinary   bool
+
+	grpcMethod   string
+	grpcProtoset string
+
 	certPath string
 	keyPath  string
 	insecure bool
@@ -130,6 +206,14 @@ type ClientOpt struct {
 	writeTimeout time.Duration
 	dialTimeout  time.Duration
 
+	disableKeepAlive   bool
+	maxRequestsPerConn int
+	connMaxLifetime    time.Duration
+
+	resolve   []string
+	dnsServer string
+	dnsMode   string
+
 	socks5Proxy string
 	httpProxy   string
 	contentType string
@@ -152,12 +236,176 @@ func NewRequester(concurrency int, requests int64, duration time.Duration, reqRa
 		clientOpt:   clientOpt,
 		recordChan:  make(chan *ReportRecord, maxResult),
 	}
-	client, header, err := buildRequestClient(clientOpt, &r.readBytes, &r.writeBytes)
+	r.conns.maxRequests = clientOpt.maxRequestsPerConn
+	client, header, err := buildRequestClient(clientOpt, &r.readBytes, &r.writeBytes, &r.conns)
 	if err != nil {
 		return nil, err
 	}
 	r.httpClient = client
 	r.httpHeader = header
+	r.isTLS = client.IsTLS
+	switch {
+	case clientOpt.h2 && clientOpt.h3:
+		return nil, errors.New("--h2 and --h3 can't be used together")
+	case clientOpt.h2:
+		r.httpClient, err = NewH2Client(clientOpt, &r.readBytes, &r.writeBytes)
+	case clientOpt.h3:
+		r.httpClient, err = NewH3Client(clientOpt, &r.readBytes, &r.writeBytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u, _ := url2.Parse(clientOpt.url)
+	if clientOpt.scenarioFile != "" {
+		if clientOpt.scriptFile != "" {
+			return nil, errors.New("--scenario and --script can't be used together")
+		}
+		if isWebSocketURL(u) || clientOpt.grpcMethod != "" || clientOpt.requestsFile != "" || clientOpt.openModel {
+			return nil, errors.New("--scenario can't be used with --requests-file, --grpc-method, --open-model or a websocket url")
+		}
+		if hasTemplate(clientOpt.url) || hasTemplate(string(clientOpt.bodyBytes)) || hasTemplate(strings.Join(clientOpt.headers, "\n")) {
+			return nil, errors.New("templates of the url, -H and --body can't be used with --scenario, use them in the steps")
+		}
+		steps, err := LoadScenarioFile(clientOpt.scenarioFile)
+		if err != nil {
+			return nil, err
+		}
+		r.scenario, err = NewScenario(steps, clientOpt)
+		if err != nil {
+			return nil, err
+		}
+	} else if clientOpt.scriptFile != "" {
+		if isWebSocketURL(u) || clientOpt.grpcMethod != "" || clientOpt.requestsFile != "" || clientOpt.openModel || clientOpt.data != nil {
+			return nil, errors.New("--script can't be used with --requests-file, --scenario, --grpc-method, --open-model, --data or a websocket url")
+		}
+		if hasTemplate(clientOpt.url) || hasTemplate(string(clientOpt.bodyBytes)) || hasTemplate(strings.Join(clientOpt.headers, "\n")) {
+			return nil, errors.New("templates of the url, -H and --body can't be used with --script, build the requests in the script")
+		}
+		if len(clientOpt.bodyBytes) > 0 || clientOpt.bodyFile != "" {
+			return nil, errors.New("--body can't be used with --script, set the body in the script")
+		}
+		r.script, err = NewScript(clientOpt.scriptFile, clientOpt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		r.templates, err = newRequestTemplates(clientOpt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.templates != nil && (isWebSocketURL(u) || clientOpt.grpcMethod != "" || clientOpt.requestsFile != "") {
+		return nil, errors.New("templates can't be used with --requests-file, --grpc-method or a websocket url")
+	}
+
+	if len(clientOpt.targets) > 1 {
+		if isWebSocketURL(u) || clientOpt.h2 || clientOpt.h3 || clientOpt.grpcMethod != "" || clientOpt.requestsFile != "" || r.scenario != nil || r.script != nil {
+			return nil, errors.New("several targets can't be used with --h2, --h3, --grpc-method, --requests-file, --scenario, --script or a websocket url")
+		}
+		for _, t := range clientOpt.targets {
+			if hasTemplate(t.URL) {
+				return nil, errors.New("templates of the url can't be used with several targets")
+			}
+		}
+		r.targets, err = NewTargetSet(clientOpt.targets, clientOpt.targetsMode, clientOpt, &r.readBytes, &r.writeBytes, &r.conns)
+		if err != nil {
+			return nil, err
+		}
+		r.httpClient = r.targets
+	}
+
+	if isWebSocketURL(u) {
+		if clientOpt.h2 || clientOpt.h3 || clientOpt.requestsFile != "" {
+			return nil, errors.New("ws:// and wss:// urls can't be used with --h2, --h3 or --requests-file")
+		}
+		r.ws, err = newWSClient(clientOpt, &r.readBytes, &r.writeBytes)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(clientOpt.wsMessages) > 0 {
+		return nil, errors.New("--ws-message requires a ws:// or wss:// url")
+	}
+
+	if clientOpt.grpcMethod != "" {
+		if clientOpt.h2 || clientOpt.h3 || r.ws != nil || clientOpt.requestsFile != "" || clientOpt.assertions != nil {
+			return nil, errors.New("--grpc-method can't be used with --h2, --h3, --requests-file, --expect-* or a websocket url")
+		}
+		r.grpc, err = newGRPCClient(clientOpt, concurrency, &r.readBytes, &r.writeBytes, errWriter)
+		if err != nil {
+			return nil, err
+		}
+	} else if clientOpt.grpcProtoset != "" {
+		return nil, errors.New("--grpc-protoset requires --grpc-method")
+	}
+
+	if clientOpt.cookieFile != "" {
+		r.fileCookies, err = LoadCookieFile(clientOpt.cookieFile)
+		if err != nil {
+			return nil, err
+		}
+		clientOpt.cookies = true
+	}
+	if clientOpt.cookies && (r.ws != nil || r.grpc != nil) {
+		return nil, errors.New("--cookies can't be used with a websocket url or --grpc-method")
+	}
+
+	if clientOpt.followRedirects > 0 {
+		if r.ws != nil || r.grpc != nil {
+			return nil, errors.New("--follow-redirects can't be used with a websocket url or --grpc-method")
+		}
+		r.redirector, err = newRedirector(r, clientOpt.followRedirects)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if clientOpt.timings {
+		if r.ws != nil || r.grpc != nil || r.targets != nil || clientOpt.h2 || clientOpt.h3 || clientOpt.followRedirects > 0 {
+			return nil, errors.New("--timings can't be used with --h2, --h3, --follow-redirects, several targets, --grpc-method or a websocket url")
+		}
+		if _, err := newRequestTrace(clientOpt, &r.readBytes, &r.writeBytes, &r.conns); err != nil {
+			return nil, err
+		}
+	}
+
+	if keepAliveSet(clientOpt) {
+		if r.ws != nil || r.grpc != nil || clientOpt.h2 || clientOpt.h3 {
+			return nil, errors.New("--disable-keepalive, --max-requests-per-conn and --conn-max-lifetime can't be used with --h2, --h3, --grpc-method or a websocket url")
+		}
+	}
+
+	if clientOpt.openModel {
+		if reqRate == nil || *reqRate <= 0 {
+			return nil, errors.New("--open-model requires --rate")
+		}
+		if r.ws != nil || r.grpc != nil {
+			return nil, errors.New("--open-model can't be used with a websocket url or --grpc-method")
+		}
+	}
+
+	if len(clientOpt.stages) > 0 || len(clientOpt.rateStages) > 0 {
+		if clientOpt.openModel {
+			return nil, errors.New("--stages and --rate-stages can't be used with --open-model")
+		}
+		if rampUp > 0 {
+			return nil, errors.New("--stages can't be used with --ramp-up")
+		}
+		if len(clientOpt.rateStages) > 0 && reqRate != nil {
+			return nil, errors.New("--rate-stages can't be used with --rate")
+		}
+	}
+
+	if clientOpt.requestsFile != "" {
+		entries, err := LoadRequestsFile(clientOpt.requestsFile)
+		if err != nil {
+			return nil, err
+		}
+		r.requestSet, err = NewRequestSet(entries, clientOpt.requestsMode, clientOpt)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return r, nil
 }
 
@@ -187,7 +435,27 @@ func buildTLSConfig(opt *ClientOpt) (*tls.Config, error) {
 	}, nil
 }
 
-func buildRequestClient(opt *ClientOpt, r *int64, w *int64) (*fasthttp.HostClient, *fasthttp.RequestHeader, error) {
+// tlsHandshake starts TLS over conn with the host of addr as the server name.
+func tlsHandshake(conn net.Conn, conf *tls.Config, addr string, timeout time.Duration) (net.Conn, error) {
+	conf = conf.Clone()
+	if conf.ServerName == "" {
+		conf.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tlsConn := tls.Client(conn, conf)
+	if timeout > 0 {
+		_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// buildRequestClient returns the HTTP/1.1 client of opt, its connections are
+// counted in cs with the keep-alive options unless it is nil.
+func buildRequestClient(opt *ClientOpt, r *int64, w *int64, cs *connStats) (*fasthttp.HostClient, *fasthttp.RequestHeader, error) {
 	u, err := url2.Parse(opt.url)
 	if err != nil {
 		return nil, nil, err
@@ -199,38 +467,71 @@ func buildRequestClient(opt *ClientOpt, r *int64, w *int64) (*fasthttp.HostClien
 		MaxConns:                      opt.maxConns,
 		ReadTimeout:                   opt.readTimeout,
 		WriteTimeout:                  opt.writeTimeout,
+		MaxConnDuration:               opt.connMaxLifetime,
 		DisableHeaderNamesNormalizing: true,
 	}
+	httpClient.Dial, err = buildDialFunc(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpClient.Dial = ThroughputInterceptorDial(httpClient.Dial, r, w)
+
+	tlsConfig, err := buildTLSConfig(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpClient.TLSConfig = tlsConfig
+	if cs != nil && keepAliveSet(opt) {
+		httpClient.Dial = cs.wrap(httpClient.Dial, httpClient.IsTLS, tlsConfig, handshakeTimeout(opt))
+	}
+	if opt.maxRequestsPerConn > 0 {
+		// every connection of the pool may refuse the request once
+		httpClient.MaxIdemponentCallAttempts = opt.maxConns + fasthttp.DefaultMaxIdemponentCallAttempts
+		httpClient.RetryIfErr = retryIfErr
+	}
+
+	requestHeader, err := buildRequestHeader(opt, opt.method, u)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return httpClient, requestHeader, nil
+}
+
+func buildDialFunc(opt *ClientOpt) (fasthttp.DialFunc, error) {
+	rs, err := newResolver(opt)
+	if err != nil {
+		return nil, err
+	}
+	var dial fasthttp.DialFunc
 	if opt.socks5Proxy != "" {
 		if !strings.Contains(opt.socks5Proxy, "://") {
 			opt.socks5Proxy = "socks5://" + opt.socks5Proxy
 		}
-		httpClient.Dial = fasthttpproxy.FasthttpSocksDialer(opt.socks5Proxy)
+		dial = fasthttpproxy.FasthttpSocksDialer(opt.socks5Proxy)
 	} else if opt.unixSocket != "" {
-		httpClient.Dial = func(addr string) (net.Conn, error) {
+		return func(addr string) (net.Conn, error) {
 			return net.Dial("unix", opt.unixSocket)
-		}
+		}, nil
 	} else if opt.httpProxy != "" {
-		httpClient.Dial = fasthttpproxy.FasthttpHTTPDialerDualStack(opt.httpProxy)
+		dial = fasthttpproxy.FasthttpHTTPDialerDualStack(opt.httpProxy)
 	} else {
 		dialer := fasthttpproxy.Dialer{
 			Timeout:        opt.dialTimeout,
 			ConnectTimeout: opt.dialTimeout,
 			DialDualStack:  true,
 		}
-		httpClient.Dial, err = dialer.GetDialFunc(true)
-		if err != nil {
-			return nil, nil, err
+		if dial, err = dialer.GetDialFunc(true); err != nil {
+			return nil, err
 		}
 	}
-	httpClient.Dial = ThroughputInterceptorDial(httpClient.Dial, r, w)
-
-	tlsConfig, err := buildTLSConfig(opt)
-	if err != nil {
-		return nil, nil, err
+	if rs != nil {
+		dial = rs.wrap(dial)
 	}
-	httpClient.TLSConfig = tlsConfig
+	return dial, nil
+}
 
+func buildRequestHeader(opt *ClientOpt, method string, u *url2.URL) (*fasthttp.RequestHeader, error) {
 	var requestHeader fasthttp.RequestHeader
 	if opt.contentType != "" {
 		requestHeader.SetContentType(opt.contentType)
@@ -240,17 +541,16 @@ func buildRequestClient(opt *ClientOpt, r *int64, w *int64) (*fasthttp.HostClien
 	} else {
 		requestHeader.SetHost(u.Host)
 	}
-	requestHeader.SetMethod(opt.method)
+	requestHeader.SetMethod(method)
 	requestHeader.SetRequestURI(u.RequestURI())
 	for _, h := range opt.headers {
 		n := strings.SplitN(h, ":", 2)
 		if len(n) != 2 {
-			return nil, nil, fmt.Errorf("invalid header: %s", h)
+			return nil, fmt.Errorf("invalid header: %s", h)
 		}
 		requestHeader.Set(strings.TrimSpace(n[0]), strings.TrimSpace(n[1]))
 	}
-
-	return httpClient, &requestHeader, nil
+	return &requestHeader, nil
 }
 
 func (r *Requester) Cancel() {
@@ -267,31 +567,175 @@ func (r *Requester) closeRecord() {
 	})
 }
 
+// newRequest returns the request template a worker reuses for every
+// request it sends.
+func (r *Requester) newRequest() *fasthttp.Request {
+	req := &fasthttp.Request{}
+	r.httpHeader.CopyTo(&req.Header)
+	if r.isTLS {
+		req.URI().SetScheme("https")
+		req.URI().SetHostBytes(req.Header.Host())
+	}
+	return req
+}
+
+// newRequestTrace returns the client of a worker that times the phases of
+// its requests, or nil without --timings.
+func (r *Requester) newRequestTrace() *requestTrace {
+	if !r.clientOpt.timings {
+		return nil
+	}
+	// the options were checked by NewRequester
+	tr, _ := newRequestTrace(r.clientOpt, &r.readBytes, &r.writeBytes, &r.conns)
+	return tr
+}
+
+// newTemplateState returns the template state of a worker, or nil when the
+// request has no templates.
+func (r *Requester) newTemplateState() *templateState {
+	if r.templates == nil {
+		return nil
+	}
+	return r.templates.ctx.newState()
+}
+
+// prepareRequest sets the next request from --requests-file, or the target
+// and the body of the single request with its templates evaluated, and
+// returns its label.
+func (r *Requester) prepareRequest(req *fasthttp.Request, ts *templateState) (string, error) {
+	if r.requestSet != nil {
+		target := r.requestSet.Next()
+		target.req.CopyTo(req)
+		return target.label, nil
+	}
+	var label string
+	if r.targets != nil {
+		target := r.targets.Next()
+		target.req.CopyTo(req)
+		label = target.label
+	}
+	// the row is taken first, the body file isn't opened once --data is
+	// exhausted
+	if ts != nil {
+		if err := ts.nextRow(); err != nil {
+			return label, err
+		}
+	}
+	if r.clientOpt.bodyFile != "" {
+		file, err := os.Open(r.clientOpt.bodyFile)
+		if err != nil {
+			return label, err
+		}
+		req.SetBodyStream(file, -1)
+	} else {
+		req.SetBodyRaw(r.clientOpt.bodyBytes)
+	}
+	if ts != nil {
+		r.templates.apply(req, ts)
+	}
+	return label, nil
+}
+
+// acquire waits for the rate limiter and takes one request from -n, it
+// returns false when the worker should stop.
+func (r *Requester) acquire(ctx context.Context, cancel func(), limiter *rate.Limiter, semaphore *int64) bool {
+	if len(r.clientOpt.rateStages) > 0 {
+		if !waitStagedRate(ctx, limiter) {
+			return false
+		}
+	} else if limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return false
+		}
+	}
+	if r.requests > 0 && atomic.AddInt64(semaphore, -1) < 0 {
+		cancel()
+		return false
+	}
+	return true
+}
+
+// sendRecord sends rr once its cost is set, with the start time it gives and
+// the counters of the run.
+func (r *Requester) sendRecord(rr *ReportRecord, label string, worker int) {
+	rr.start = time.Now().Add(-rr.cost)
+	rr.worker = worker
+	rr.readBytes = atomic.LoadInt64(&r.readBytes)
+	rr.writeBytes = atomic.LoadInt64(&r.writeBytes)
+	rr.conns = r.conns.load()
+	rr.dropped = atomic.LoadInt64(&r.dropped)
+	rr.late = atomic.LoadInt64(&r.late)
+	rr.concurrencyCount = int(atomic.LoadInt64(&r.concurrencyCount))
+	rr.label = label
+	r.recordChan <- rr
+}
+
 func (r *Requester) DoRequest(req *fasthttp.Request, resp *fasthttp.Response, rr *ReportRecord) {
+	r.doRequest(req, resp, rr, nil, nil)
+}
+
+func (r *Requester) send(client HTTPClient, req *fasthttp.Request, resp *fasthttp.Response) error {
+	if r.clientOpt.disableKeepAlive {
+		req.SetConnectionClose()
+	}
+	if r.clientOpt.doTimeout > 0 {
+		return client.DoTimeout(req, resp, r.clientOpt.doTimeout)
+	}
+	return client.Do(req, resp)
+}
+
+// doRequest sends req with the cookies of jar and follows its redirects, rr
+// gets the latency of all the hops and the last response, and its phases
+// when tr is set.
+func (r *Requester) doRequest(req *fasthttp.Request, resp *fasthttp.Response, rr *ReportRecord, jar *cookieJar, tr *requestTrace) {
 	startTime := time.Unix(0, atomic.LoadInt64(&startTimeUnixNano))
 	t1 := time.Since(startTime)
-	var err error
-	if r.clientOpt.doTimeout > 0 {
-		err = r.httpClient.DoTimeout(req, resp, r.clientOpt.doTimeout)
-	} else {
-		err = r.httpClient.Do(req, resp)
+	rr.redirects = rr.redirects[:0]
+	rr.bytes = 0
+	jar.addCookies(req)
+	client := r.httpClient
+	if tr != nil {
+		client = tr.client
+		tr.start()
 	}
+	err := r.send(client, req, resp)
+	if tr != nil && err == nil {
+		tr.finish(rr)
+	}
+	if err == nil {
+		jar.storeCookies(req, resp)
+		if r.redirector != nil {
+			err = r.redirector.follow(req, resp, rr, jar)
+		}
+	}
+	jar.resetCookies(req)
 
 	if err != nil {
 		rr.cost = time.Since(startTime) - t1
+		rr.code = 0
 		rr.error = err.Error()
 		return
 	}
 
+	var assertErr error
+	if r.clientOpt.assertions != nil {
+		assertErr = r.clientOpt.assertions.Check(resp)
+	}
+
 	writeTo := io.Discard
-	if resp.StatusCode() >= 500 {
+	if resp.StatusCode() >= 500 || assertErr != nil {
 		writeTo = r.errWriter
+		if assertErr != nil {
+			_, _ = r.errWriter.Write([]byte("\n" + assertErr.Error()))
+		}
 		_, _ = r.errWriter.Write([]byte(fmt.Sprintf("\n%d %s\n", resp.StatusCode(), rr.cost)))
 		_, _ = r.errWriter.Write([]byte(fmt.Sprintf("%s", &resp.Header)))
 	}
+	rr.bytes = int64(len(resp.Body()))
 	err = resp.BodyWriteTo(writeTo)
 	if err != nil {
 		rr.cost = time.Since(startTime) - t1
+		rr.code = 0
 		rr.error = err.Error()
 		return
 	}
@@ -299,6 +743,9 @@ func (r *Requester) DoRequest(req *fasthttp.Request, resp *fasthttp.Response, rr
 	rr.cost = time.Since(startTime) - t1
 	rr.code = resp.StatusCode()
 	rr.error = ""
+	if assertErr != nil {
+		rr.error = assertErr.Error()
+	}
 }
 
 func (r *Requester) Run() {
@@ -323,6 +770,10 @@ func (r *Requester) Run() {
 		cancelFunc()
 		<-signalDone
 	}()
+	if r.grpc != nil {
+		// the workers are done once Run returns, so are the connections
+		defer r.grpc.close()
+	}
 	atomic.StoreInt64(&startTimeUnixNano, time.Now().UnixNano())
 	if r.duration > 0 {
 		time.AfterFunc(r.duration, func() {
@@ -335,8 +786,39 @@ func (r *Requester) Run() {
 	if r.reqRate != nil {
 		limiter = rate.NewLimiter(*r.reqRate, 1)
 	}
+	if len(r.clientOpt.rateStages) > 0 {
+		limiter = rate.NewLimiter(minStageRate, 1)
+	}
+
+	if r.clientOpt.openModel {
+		r.runOpenModel(ctx)
+		r.wg.Wait()
+		r.closeRecord()
+		return
+	}
 
 	semaphore := r.requests
+	startWorker := func(ctx context.Context, id int) {
+		r.wg.Add(1)
+		go func() {
+			defer func() {
+				r.wg.Done()
+				v := recover()
+				if v != nil && v != sendOnCloseError {
+					panic(v)
+				}
+			}()
+			r.runWorker(ctx, cancelFunc, limiter, &semaphore, id)
+		}()
+	}
+
+	if len(r.clientOpt.stages) > 0 || len(r.clientOpt.rateStages) > 0 {
+		r.runStages(ctx, cancelFunc, limiter, startWorker)
+		r.wg.Wait()
+		r.closeRecord()
+		return
+	}
+
 	if r.rampUp <= 0 {
 		r.rampUp = r.concurrency
 	}
@@ -348,67 +830,8 @@ func (r *Requester) Run() {
 				break
 			}
 			concurrencyCount++
-			r.wg.Add(1)
-			go func() {
-				defer func() {
-					r.wg.Done()
-					v := recover()
-					if v != nil && v != sendOnCloseError {
-						panic(v)
-					}
-				}()
-				req := &fasthttp.Request{}
-				resp := &fasthttp.Response{}
-				r.httpHeader.CopyTo(&req.Header)
-				if r.httpClient.IsTLS {
-					req.URI().SetScheme("https")
-					req.URI().SetHostBytes(req.Header.Host())
-				}
-
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					default:
-					}
-
-					if limiter != nil {
-						err := limiter.Wait(ctx)
-						if err != nil {
-							continue
-						}
-					}
-
-					if r.requests > 0 && atomic.AddInt64(&semaphore, -1) < 0 {
-						cancelFunc()
-						return
-					}
-
-					if r.clientOpt.bodyFile != "" {
-						file, err := os.Open(r.clientOpt.bodyFile)
-						if err != nil {
-							rr := recordPool.Get().(*ReportRecord)
-							rr.cost = 0
-							rr.error = err.Error()
-							rr.readBytes = atomic.LoadInt64(&r.readBytes)
-							rr.writeBytes = atomic.LoadInt64(&r.writeBytes)
-							rr.concurrencyCount = concurrencyCount
-							r.recordChan <- rr
-							continue
-						}
-						req.SetBodyStream(file, -1)
-					} else {
-						req.SetBodyRaw(r.clientOpt.bodyBytes)
-					}
-					resp.Reset()
-					rr := recordPool.Get().(*ReportRecord)
-					r.DoRequest(req, resp, rr)
-					rr.readBytes = atomic.LoadInt64(&r.readBytes)
-					rr.writeBytes = atomic.LoadInt64(&r.writeBytes)
-					rr.concurrencyCount = concurrencyCount
-					r.recordChan <- rr
-				}
-			}()
+			atomic.StoreInt64(&r.concurrencyCount, int64(concurrencyCount))
+			startWorker(ctx, concurrencyCount)
 		}
 		if r.rampUp != r.concurrency {
 			time.Sleep(time.Second)
@@ -418,3 +841,59 @@ func (r *Requester) Run() {
 	r.wg.Wait()
 	r.closeRecord()
 }
+
+// runWorker sends requests until ctx is done, the id numbers the workers
+// from 1.
+func (r *Requester) runWorker(ctx context.Context, cancel func(), limiter *rate.Limiter, semaphore *int64, id int) {
+	if r.ws != nil {
+		r.runWebSocketWorker(ctx, cancel, limiter, semaphore, id)
+		return
+	}
+	if r.grpc != nil {
+		r.runGRPCWorker(ctx, cancel, limiter, semaphore, id)
+		return
+	}
+	if r.scenario != nil {
+		r.runScenarioWorker(ctx, cancel, limiter, semaphore, id)
+		return
+	}
+	if r.script != nil {
+		r.runScriptWorker(ctx, cancel, limiter, semaphore, id)
+		return
+	}
+
+	req := r.newRequest()
+	resp := &fasthttp.Response{}
+	ts := r.newTemplateState()
+	jar := r.newCookieJar()
+	tr := r.newRequestTrace()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if !r.acquire(ctx, cancel, limiter, semaphore) {
+			continue
+		}
+
+		rr := recordPool.Get().(*ReportRecord)
+		label, err := r.prepareRequest(req, ts)
+		if err == errDataExhausted {
+			recordPool.Put(rr)
+			cancel()
+			return
+		}
+		if err != nil {
+			rr.cost = 0
+			rr.code = 0
+			rr.error = err.Error()
+			r.sendRecord(rr, label, id)
+			continue
+		}
+		resp.Reset()
+		r.doRequest(req, resp, rr, jar, tr)
+		r.sendRecord(rr, label, id)
+	}
+}
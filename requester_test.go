@@ -68,7 +68,7 @@ func TestBuildRequestClientUsesDualStackDialer(t *testing.T) {
 			dialTimeout: time.Second,
 			doTimeout:   time.Second,
 		}
-		client, header, err := buildRequestClient(opt, new(int64), new(int64))
+		client, header, err := buildRequestClient(opt, new(int64), new(int64), nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -126,7 +126,7 @@ func TestBuildRequestClientUsesHTTPProxy(t *testing.T) {
 				doTimeout:   time.Second,
 				httpProxy:   tt.httpProxy,
 			}
-			client, header, err := buildRequestClient(opt, new(int64), new(int64))
+			client, header, err := buildRequestClient(opt, new(int64), new(int64), nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -176,3 +176,50 @@ func startTestProxy(t *testing.T) (string, *int64) {
 
 	return ln.Addr().String(), &hits
 }
+
+// startServer serves handler on a local port until the test ends and
+// returns its address.
+func startServer(t *testing.T, handler fasthttp.RequestHandler) string {
+	t.Helper()
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		_ = fasthttp.Serve(ln, handler)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("test server did not stop")
+		}
+	})
+	return ln.Addr().String()
+}
+
+// collectRecords runs requester and returns a copy of its records, the run
+// has to stop within 5s.
+func collectRecords(t *testing.T, requester *Requester) []*ReportRecord {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		requester.Run()
+		close(done)
+	}()
+	var records []*ReportRecord
+	for record := range requester.RecordChan() {
+		rr := *record
+		rr.redirects = append([]int(nil), record.redirects...)
+		records = append(records, &rr)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run didn't stop")
+	}
+	return records
+}
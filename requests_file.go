@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	url2 "net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+var requestsModes = []string{"round-robin", "random", "weighted"}
+
+// RequestEntry is a single line of the --requests-file JSON Lines file.
+type RequestEntry struct {
+	Method   string            `json:"method"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	Body     string            `json:"body"`
+	BodyFile string            `json:"body_file"`
+	Weight   int               `json:"weight"`
+	Label    string            `json:"label"`
+}
+
+func LoadRequestsFile(path string) ([]*RequestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*RequestEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		entry := &RequestEntry{}
+		if err := json.Unmarshal(line, entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		if entry.BodyFile != "" && !filepath.IsAbs(entry.BodyFile) {
+			entry.BodyFile = filepath.Join(filepath.Dir(path), entry.BodyFile)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no requests found", path)
+	}
+	return entries, nil
+}
+
+type requestTarget struct {
+	label  string
+	weight int
+	req    fasthttp.Request
+}
+
+// RequestSet hands out the requests of a requests file to the workers.
+type RequestSet struct {
+	targets     []*requestTarget
+	mode        string
+	cursor      uint64
+	totalWeight int
+}
+
+func NewRequestSet(entries []*RequestEntry, mode string, opt *ClientOpt) (*RequestSet, error) {
+	base, err := url2.Parse(opt.url)
+	if err != nil {
+		return nil, err
+	}
+	s := &RequestSet{mode: mode}
+	for i, entry := range entries {
+		t, err := buildRequestTarget(entry, base, opt)
+		if err != nil {
+			return nil, fmt.Errorf("request #%d: %v", i+1, err)
+		}
+		s.targets = append(s.targets, t)
+		s.totalWeight += t.weight
+	}
+	return s, nil
+}
+
+func buildRequestTarget(entry *RequestEntry, base *url2.URL, opt *ClientOpt) (*requestTarget, error) {
+	ref, err := url2.Parse(entry.URL)
+	if err != nil {
+		return nil, err
+	}
+	u := base.ResolveReference(ref)
+	if u.Scheme != base.Scheme || u.Host != base.Host {
+		return nil, fmt.Errorf("url %s does not target %s://%s", u, base.Scheme, base.Host)
+	}
+
+	body := []byte(entry.Body)
+	if entry.BodyFile != "" {
+		body, err = os.ReadFile(entry.BodyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	method := entry.Method
+	if method == "" {
+		method = fasthttp.MethodGet
+		if len(body) > 0 {
+			method = fasthttp.MethodPost
+		}
+	}
+
+	header, err := buildRequestHeader(opt, method, u)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range entry.Headers {
+		header.Set(k, v)
+	}
+
+	t := &requestTarget{label: entry.Label, weight: entry.Weight}
+	if t.label == "" {
+		t.label = method + " " + u.RequestURI()
+	}
+	if t.weight < 0 {
+		return nil, fmt.Errorf("negative weight %d", t.weight)
+	}
+	if t.weight == 0 {
+		t.weight = 1
+	}
+	header.CopyTo(&t.req.Header)
+	if u.Scheme == "https" {
+		t.req.URI().SetScheme("https")
+		t.req.URI().SetHostBytes(t.req.Header.Host())
+	}
+	t.req.SetBodyRaw(body)
+	return t, nil
+}
+
+func (s *RequestSet) Len() int {
+	return len(s.targets)
+}
+
+func (s *RequestSet) Next() *requestTarget {
+	switch s.mode {
+	case "random":
+		return s.targets[rand.Intn(len(s.targets))]
+	case "weighted":
+		n := rand.Intn(s.totalWeight)
+		for _, t := range s.targets {
+			if n < t.weight {
+				return t
+			}
+			n -= t.weight
+		}
+	}
+	i := atomic.AddUint64(&s.cursor, 1) - 1
+	return s.targets[i%uint64(len(s.targets))]
+}
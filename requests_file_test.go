@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func writeRequestsFile(t *testing.T, content string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "requests.jsonl")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRequestsFile(t *testing.T) {
+	path := writeRequestsFile(t, `
+# comments and blank lines are skipped
+{"url": "/a"}
+
+{"method": "PUT", "url": "/b", "headers": {"X-Test": "1"}, "body_file": "body.json", "weight": 3, "label": "put b"}
+`)
+
+	entries, err := LoadRequestsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries len = %d, want 2", len(entries))
+	}
+	if entries[0].URL != "/a" || entries[0].Method != "" {
+		t.Fatalf("entries[0] = %+v, want url /a without method", entries[0])
+	}
+	b := entries[1]
+	if b.Method != "PUT" || b.Headers["X-Test"] != "1" || b.Weight != 3 || b.Label != "put b" {
+		t.Fatalf("entries[1] = %+v, want PUT /b with header, weight and label", b)
+	}
+	if want := filepath.Join(filepath.Dir(path), "body.json"); b.BodyFile != want {
+		t.Fatalf("BodyFile = %q, want %q relative to the requests file", b.BodyFile, want)
+	}
+}
+
+func TestLoadRequestsFileRejectsInvalidInput(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty":        "\n# nothing here\n",
+		"invalid json": `{"url": "/a"` + "\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadRequestsFile(writeRequestsFile(t, content)); err == nil {
+				t.Fatal("LoadRequestsFile succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestNewRequestSetBuildsRequests(t *testing.T) {
+	opt := &ClientOpt{
+		url:     "https://example.com/base/",
+		method:  fasthttp.MethodGet,
+		headers: []string{"X-Global: yes"},
+	}
+	set, err := NewRequestSet([]*RequestEntry{
+		{URL: "items?page=1"},
+		{URL: "https://example.com/create", Body: `{"a":1}`, Headers: map[string]string{"X-Global": "no"}},
+		{Method: "DELETE", URL: "/items/1", Label: "delete"},
+	}, "round-robin", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label  string
+		method string
+		uri    string
+		global string
+		body   string
+	}{
+		{"GET /base/items?page=1", fasthttp.MethodGet, "/base/items?page=1", "yes", ""},
+		{"POST /create", fasthttp.MethodPost, "/create", "no", `{"a":1}`},
+		{"delete", fasthttp.MethodDelete, "/items/1", "yes", ""},
+	}
+	for i, tt := range tests {
+		target := set.targets[i]
+		if target.label != tt.label {
+			t.Fatalf("targets[%d].label = %q, want %q", i, target.label, tt.label)
+		}
+		var req fasthttp.Request
+		target.req.CopyTo(&req)
+		if got := string(req.Header.Method()); got != tt.method {
+			t.Fatalf("targets[%d] method = %q, want %q", i, got, tt.method)
+		}
+		if got := string(req.URI().RequestURI()); got != tt.uri {
+			t.Fatalf("targets[%d] uri = %q, want %q", i, got, tt.uri)
+		}
+		if got := string(req.URI().Scheme()); got != "https" {
+			t.Fatalf("targets[%d] scheme = %q, want https", i, got)
+		}
+		if got := string(req.Header.Peek("X-Global")); got != tt.global {
+			t.Fatalf("targets[%d] X-Global = %q, want %q", i, got, tt.global)
+		}
+		if got := string(req.Body()); got != tt.body {
+			t.Fatalf("targets[%d] body = %q, want %q", i, got, tt.body)
+		}
+	}
+}
+
+func TestNewRequestSetRejectsOtherHosts(t *testing.T) {
+	_, err := NewRequestSet([]*RequestEntry{{URL: "http://other.example/"}}, "round-robin", &ClientOpt{url: "http://example.com/"})
+	if err == nil {
+		t.Fatal("NewRequestSet accepted a url on another host, want error")
+	}
+}
+
+func TestRequestSetNext(t *testing.T) {
+	entries := []*RequestEntry{{URL: "/a", Weight: 1}, {URL: "/b", Weight: 3}, {URL: "/c", Weight: 0}}
+	opt := &ClientOpt{url: "http://example.com/"}
+
+	t.Run("round-robin", func(t *testing.T) {
+		set, err := NewRequestSet(entries, "round-robin", opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 6; i++ {
+			if got, want := set.Next(), set.targets[i%3]; got != want {
+				t.Fatalf("Next() #%d = %q, want %q", i, got.label, want.label)
+			}
+		}
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		set, err := NewRequestSet(entries, "weighted", opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set.totalWeight != 5 {
+			t.Fatalf("totalWeight = %d, want 5 with zero weight defaulting to 1", set.totalWeight)
+		}
+		counts := map[string]int{}
+		for i := 0; i < 5000; i++ {
+			counts[set.Next().label]++
+		}
+		if counts["GET /b"] < 2*counts["GET /a"] || counts["GET /c"] == 0 {
+			t.Fatalf("weighted picks = %v, want /b about three times as often as /a", counts)
+		}
+	})
+}
+
+func TestRequesterRunUsesRequestsFile(t *testing.T) {
+	var mu sync.Mutex
+	paths := map[string]int{}
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		paths[string(ctx.Method())+" "+string(ctx.Path())]++
+		mu.Unlock()
+	})
+
+	path := writeRequestsFile(t, `{"url": "/one", "label": "one"}
+{"method": "POST", "url": "/two", "body": "x", "label": "two"}
+`)
+	requester, err := NewRequester(1, 4, 0, nil, io.Discard, &ClientOpt{
+		url:          "http://" + addr + "/",
+		method:       fasthttp.MethodGet,
+		requestsFile: path,
+		requestsMode: "round-robin",
+		maxConns:     1,
+		dialTimeout:  time.Second,
+		doTimeout:    time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]int{}
+	for _, record := range collectRecords(t, requester) {
+		if record.error != "" || record.code != fasthttp.StatusOK {
+			t.Fatalf("record = code %d error %q, want 200", record.code, record.error)
+		}
+		labels[record.label]++
+	}
+	if labels["one"] != 2 || labels["two"] != 2 {
+		t.Fatalf("record labels = %v, want one=2 two=2", labels)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if paths["GET /one"] != 2 || paths["POST /two"] != 2 {
+		t.Fatalf("server saw %v, want GET /one and POST /two twice each", paths)
+	}
+}
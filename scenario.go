@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	url2 "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/time/rate"
+)
+
+// scenarioJourneyLabel is the label of the whole journey latency, it sorts
+// after the numbered step labels.
+const scenarioJourneyLabel = "journey"
+
+// ScenarioStep is a single line of the --scenario JSON Lines file, a
+// request of --requests-file plus the values to extract from its response.
+type ScenarioStep struct {
+	RequestEntry
+	Extract []*Extractor `json:"extract"`
+}
+
+// Extractor stores a value of a response into a variable that the next
+// steps read with {{var "NAME"}}. The value comes from a JSON path of the
+// body, a header, or the body, a regex picks its first group or its match.
+type Extractor struct {
+	Var      string `json:"var"`
+	JSONPath string `json:"json_path"`
+	Header   string `json:"header"`
+	Regex    string `json:"regex"`
+
+	re *regexp.Regexp
+}
+
+func LoadScenarioFile(path string) ([]*ScenarioStep, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var steps []*ScenarioStep
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		step := &ScenarioStep{}
+		if err := json.Unmarshal(line, step); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		if step.BodyFile != "" && !filepath.IsAbs(step.BodyFile) {
+			step.BodyFile = filepath.Join(filepath.Dir(path), step.BodyFile)
+		}
+		steps = append(steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("%s: no steps found", path)
+	}
+	return steps, nil
+}
+
+type scenarioStep struct {
+	target    *requestTarget
+	templates *requestTemplates
+	extract   []*Extractor
+}
+
+// Scenario is the journey every worker runs from the first step to the
+// last, each worker keeps its own variables.
+type Scenario struct {
+	steps []*scenarioStep
+	ctx   *templateContext
+}
+
+func NewScenario(steps []*ScenarioStep, opt *ClientOpt) (*Scenario, error) {
+	base, err := url2.Parse(opt.url)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{ctx: newTemplateContext(opt.data)}
+	width := len(strconv.Itoa(len(steps)))
+	for i, step := range steps {
+		ss, err := s.newStep(step, base, opt)
+		if err != nil {
+			return nil, fmt.Errorf("step #%d: %v", i+1, err)
+		}
+		// numbered and padded so that the label table lists the steps in order
+		ss.target.label = fmt.Sprintf("%0*d. %s", width, i+1, ss.target.label)
+		s.steps = append(s.steps, ss)
+	}
+	if opt.data != nil && !s.ctx.usesData {
+		return nil, errors.New(`--data requires {{data "COLUMN"}} in a step of --scenario`)
+	}
+	return s, nil
+}
+
+func (s *Scenario) newStep(step *ScenarioStep, base *url2.URL, opt *ClientOpt) (*scenarioStep, error) {
+	entry := step.RequestEntry
+	if entry.Label == "" && hasTemplate(entry.URL) {
+		// the default label would be the escaped template
+		entry.Label = entry.Method
+		if entry.Label == "" {
+			entry.Label = fasthttp.MethodGet
+			if entry.Body != "" || entry.BodyFile != "" {
+				entry.Label = fasthttp.MethodPost
+			}
+		}
+		entry.Label += " " + entry.URL
+	}
+	target, err := buildRequestTarget(&entry, base, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var uri string
+	if hasTemplate(entry.URL) {
+		ref, _ := url2.Parse(entry.URL)
+		u := base.ResolveReference(ref)
+		uri = u.Path
+		if u.RawQuery != "" {
+			uri += "?" + u.RawQuery
+		}
+	}
+	headers := make([]string, 0, len(entry.Headers))
+	for k, v := range entry.Headers {
+		headers = append(headers, k+": "+v)
+	}
+	sort.Strings(headers)
+	templates, err := s.ctx.compileRequest(uri, headers, entry.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range step.Extract {
+		if e.Var == "" {
+			return nil, errors.New("extract: var is required")
+		}
+		if e.JSONPath != "" && e.Header != "" {
+			return nil, fmt.Errorf("extract %s: json_path and header can't be used together", e.Var)
+		}
+		if e.JSONPath == "" && e.Header == "" && e.Regex == "" {
+			return nil, fmt.Errorf("extract %s: one of json_path, header or regex is required", e.Var)
+		}
+		if e.Regex != "" {
+			if e.re, err = regexp.Compile(e.Regex); err != nil {
+				return nil, fmt.Errorf("extract %s: %v", e.Var, err)
+			}
+		}
+	}
+	return &scenarioStep{target: target, templates: templates, extract: step.Extract}, nil
+}
+
+func (s *Scenario) Len() int {
+	return len(s.steps)
+}
+
+// extractVars sets the variables of the step from resp.
+func (ss *scenarioStep) extractVars(resp *fasthttp.Response, vars map[string]string) error {
+	var doc interface{}
+	for _, e := range ss.extract {
+		var v []byte
+		switch {
+		case e.JSONPath != "":
+			if doc == nil {
+				var err error
+				if doc, err = decodeJSON(resp.Body()); err != nil {
+					return fmt.Errorf("extract %s: body is not valid JSON", e.Var)
+				}
+			}
+			jv, ok := lookupJSONPath(doc, e.JSONPath)
+			if !ok {
+				return fmt.Errorf("extract %s: json path %s is missing", e.Var, e.JSONPath)
+			}
+			v = []byte(jsonValueString(jv))
+		case e.Header != "":
+			v = resp.Header.Peek(e.Header)
+			if v == nil {
+				return fmt.Errorf("extract %s: header %s is missing", e.Var, e.Header)
+			}
+		default:
+			v = resp.Body()
+		}
+		if e.re != nil {
+			m := e.re.FindSubmatch(v)
+			if m == nil {
+				return fmt.Errorf("extract %s: no match for /%s/", e.Var, e.re)
+			}
+			v = m[0]
+			if len(m) > 1 {
+				v = m[1]
+			}
+		}
+		vars[e.Var] = string(v)
+	}
+	return nil
+}
+
+// runScenarioWorker is the worker loop of --scenario, -n and --rate count
+// journeys. A step that fails or can't extract its variables ends the
+// journey, which is recorded with the error of that step.
+func (r *Requester) runScenarioWorker(ctx context.Context, cancel func(), limiter *rate.Limiter, semaphore *int64, id int) {
+	s := r.scenario
+	ts := s.ctx.newState()
+	jar := r.newCookieJar()
+	tr := r.newRequestTrace()
+	reqs := make([]*fasthttp.Request, len(s.steps))
+	for i, step := range s.steps {
+		reqs[i] = &fasthttp.Request{}
+		step.target.req.CopyTo(reqs[i])
+	}
+	resp := &fasthttp.Response{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if !r.acquire(ctx, cancel, limiter, semaphore) {
+			continue
+		}
+		if err := ts.nextRow(); err != nil {
+			cancel()
+			return
+		}
+		for k := range ts.vars {
+			delete(ts.vars, k)
+		}
+
+		startTime := time.Now()
+		var code int
+		var journeyErr string
+		for i, step := range s.steps {
+			rr := recordPool.Get().(*ReportRecord)
+			if step.templates != nil {
+				step.templates.apply(reqs[i], ts)
+			}
+			resp.Reset()
+			r.doRequest(reqs[i], resp, rr, jar, tr)
+			if rr.error == "" {
+				if err := step.extractVars(resp, ts.vars); err != nil {
+					rr.error = err.Error()
+				}
+			}
+			code, journeyErr = rr.code, rr.error
+			r.sendRecord(rr, step.target.label, id)
+			if journeyErr != "" {
+				break
+			}
+		}
+
+		rr := recordPool.Get().(*ReportRecord)
+		rr.cost = time.Since(startTime)
+		rr.code = code
+		rr.error = journeyErr
+		rr.labelOnly = true
+		r.sendRecord(rr, scenarioJourneyLabel, id)
+	}
+}
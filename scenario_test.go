@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func startJourneyServer(t *testing.T) string {
+	t.Helper()
+	return "http://" + startServer(t, func(ctx *fasthttp.RequestCtx) {
+		switch string(ctx.Path()) {
+		case "/login":
+			ctx.Response.Header.Set("X-Session", "sid=s-"+string(ctx.PostBody()))
+			ctx.SetBodyString(`{"data": {"token": "t-` + string(ctx.PostBody()) + `"}}`)
+		case "/profile":
+			if string(ctx.Request.Header.Peek("Authorization")) != "Bearer t-alice" {
+				ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+				return
+			}
+			ctx.SetBodyString(`<id>42</id>`)
+		case "/users/42":
+			if string(ctx.QueryArgs().Peek("session")) != "s-alice" {
+				ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			}
+		default:
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		}
+	})
+}
+
+func runScenario(t *testing.T, url, scenario string, requests int64) map[string][]*ReportRecord {
+	t.Helper()
+	requester, err := NewRequester(2, requests, 0, nil, io.Discard, &ClientOpt{
+		url:          url,
+		method:       fasthttp.MethodGet,
+		scenarioFile: writeDataFile(t, "scenario.jsonl", scenario),
+		maxConns:     2,
+		dialTimeout:  time.Second,
+		doTimeout:    time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string][]*ReportRecord{}
+	for _, rr := range collectRecords(t, requester) {
+		labels[rr.label] = append(labels[rr.label], rr)
+	}
+	return labels
+}
+
+const testScenario = `
+# log in, read the profile and update it
+{"label": "login", "method": "POST", "url": "/login", "body": "alice", "extract": [{"var": "token", "json_path": "data.token"}, {"var": "session", "header": "X-Session", "regex": "sid=(.*)"}]}
+{"label": "profile", "url": "/profile", "headers": {"Authorization": "Bearer {{var \"token\"}}"}, "extract": [{"var": "id", "regex": "<id>(\\d+)</id>"}]}
+{"method": "PUT", "url": "/users/{{var \"id\"}}?session={{var \"session\"}}"}
+`
+
+func TestScenarioRunsJourneys(t *testing.T) {
+	labels := runScenario(t, startJourneyServer(t), testScenario, 5)
+	for _, label := range []string{"1. login", "2. profile", `3. PUT /users/{{var "id"}}?session={{var "session"}}`, scenarioJourneyLabel} {
+		records := labels[label]
+		if len(records) != 5 {
+			t.Fatalf("%d records for %q, want 5, got labels %v", len(records), label, labels)
+		}
+		for _, rr := range records {
+			if rr.code != fasthttp.StatusOK || rr.error != "" {
+				t.Fatalf("%s record = code %d error %q, want 200", label, rr.code, rr.error)
+			}
+			if rr.labelOnly != (label == scenarioJourneyLabel) {
+				t.Fatalf("%s record labelOnly = %v", label, rr.labelOnly)
+			}
+		}
+	}
+	minCost := func(records []*ReportRecord) time.Duration {
+		m := records[0].cost
+		for _, rr := range records {
+			if rr.cost < m {
+				m = rr.cost
+			}
+		}
+		return m
+	}
+	if journey, login := minCost(labels[scenarioJourneyLabel]), minCost(labels["1. login"]); journey < login {
+		t.Fatalf("fastest journey took %s, want at least the fastest first step %s", journey, login)
+	}
+}
+
+func TestScenarioStepLabelsSortInOrder(t *testing.T) {
+	steps, err := LoadScenarioFile(writeDataFile(t, "scenario.jsonl", strings.Repeat(`{"url": "/step"}`+"\n", 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewScenario(steps, &ClientOpt{url: "http://127.0.0.1:1/", method: fasthttp.MethodGet, maxConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, step := range s.steps {
+		labels = append(labels, step.target.label)
+	}
+	if labels[0] != "01. GET /step" || labels[9] != "10. GET /step" || !sort.StringsAreSorted(labels) {
+		t.Fatalf("labels = %q, want them padded to sort in order", labels)
+	}
+}
+
+func TestScenarioExtractFailureEndsJourney(t *testing.T) {
+	labels := runScenario(t, startJourneyServer(t), `
+{"label": "login", "method": "POST", "url": "/login", "body": "alice", "extract": [{"var": "token", "json_path": "data.missing"}]}
+{"label": "profile", "url": "/profile"}
+`, 3)
+	if len(labels["2. profile"]) != 0 {
+		t.Fatalf("%d profile requests were sent after a failed extraction, want 0", len(labels["2. profile"]))
+	}
+	for _, label := range []string{"1. login", scenarioJourneyLabel} {
+		if len(labels[label]) != 3 {
+			t.Fatalf("%d records for %q, want 3", len(labels[label]), label)
+		}
+		for _, rr := range labels[label] {
+			if !strings.Contains(rr.error, "extract token: json path data.missing is missing") {
+				t.Fatalf("%s error = %q, want the extraction failure", label, rr.error)
+			}
+		}
+	}
+}
+
+func TestScenarioRejectsInvalidInput(t *testing.T) {
+	url := startJourneyServer(t)
+	for name, scenario := range map[string]string{
+		"empty":         "# nothing\n",
+		"invalid json":  `{"url": "/login"` + "\n",
+		"no var":        `{"url": "/login", "extract": [{"json_path": "a"}]}` + "\n",
+		"no source":     `{"url": "/login", "extract": [{"var": "a"}]}` + "\n",
+		"two sources":   `{"url": "/login", "extract": [{"var": "a", "json_path": "a", "header": "b"}]}` + "\n",
+		"invalid regex": `{"url": "/login", "extract": [{"var": "a", "regex": "("}]}` + "\n",
+		"other host":    `{"url": "http://example.com/login"}` + "\n",
+		"template":      `{"url": "/{{nope}}"}` + "\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: url, scenarioFile: writeDataFile(t, "scenario.jsonl", scenario)}, -1)
+			if err == nil {
+				t.Fatal("NewRequester succeeded, want error")
+			}
+		})
+	}
+
+	_, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: url + "/{{seq}}", scenarioFile: writeDataFile(t, "scenario.jsonl", testScenario)}, -1)
+	if err == nil {
+		t.Fatal("NewRequester accepted a templated url with --scenario")
+	}
+}
+
+func TestStreamReportCountsLabelOnlyRecordsInTheirLabel(t *testing.T) {
+	records := make(chan *ReportRecord, 2)
+	records <- &ReportRecord{cost: time.Millisecond, code: 200, label: "1. login"}
+	records <- &ReportRecord{cost: 3 * time.Millisecond, code: 200, label: scenarioJourneyLabel, labelOnly: true}
+	close(records)
+
+	report := NewStreamReport()
+	report.Collect(records)
+	if report.latencyStats.count != 1 || report.codes[200] != 1 {
+		t.Fatalf("global stats = %d records, codes %v, want only the step", report.latencyStats.count, report.codes)
+	}
+	if l := report.labels[scenarioJourneyLabel]; l == nil || l.latencyStats.count != 1 {
+		t.Fatal("the journey record is missing from its label")
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	url2 "net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/time/rate"
+)
+
+// scriptMetricPrefix is the label prefix of the values recorded with
+// metric(name, ms) in a --script.
+const scriptMetricPrefix = "metric "
+
+// scriptStopGrace is how long the current iteration may run once the run is
+// over, a script stuck in a loop is interrupted after it.
+const scriptStopGrace = time.Second
+
+// Script is a JavaScript file that builds the requests and checks the
+// responses. It may define:
+//
+//	setup()              called once before the run, its result is the data argument
+//	request(vu, iter, data) returns a url, or {method, url, headers, body, label}
+//	check(resp)          gets {status, headers, body, latency, label}, returns
+//	                     false or an error message to fail the request
+//
+// and call metric(name, ms) to record a custom timing under its own label.
+// Every worker runs the script in its own runtime.
+type Script struct {
+	program *goja.Program
+	base    *url2.URL
+	data    string
+}
+
+func NewScript(path string, opt *ClientOpt) (*Script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	program, err := goja.Compile(path, string(src), false)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url2.Parse(opt.url)
+	if err != nil {
+		return nil, err
+	}
+	s := &Script{program: program, base: base, data: "null"}
+
+	vm, err := s.newRuntime(func(string, float64) {})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := goja.AssertFunction(vm.Get("request")); !ok {
+		return nil, fmt.Errorf("%s: function request(vu, iter, data) is not defined", path)
+	}
+	if setup, ok := goja.AssertFunction(vm.Get("setup")); ok {
+		v, err := setup(goja.Undefined())
+		if err != nil {
+			return nil, fmt.Errorf("%s: setup: %v", path, err)
+		}
+		b, err := json.Marshal(v.Export())
+		if err != nil {
+			return nil, fmt.Errorf("%s: setup: %v", path, err)
+		}
+		s.data = string(b)
+	}
+	return s, nil
+}
+
+func (s *Script) newRuntime(metric func(name string, ms float64)) (*goja.Runtime, error) {
+	vm := goja.New()
+	if err := vm.Set("metric", metric); err != nil {
+		return nil, err
+	}
+	if _, err := vm.RunProgram(s.program); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// scriptVU is the runtime of one worker.
+type scriptVU struct {
+	s       *Script
+	vm      *goja.Runtime
+	request goja.Callable
+	check   goja.Callable
+	data    goja.Value
+	id      goja.Value
+	iter    int64
+}
+
+func (s *Script) newVU(id int, metric func(name string, ms float64)) (*scriptVU, error) {
+	vm, err := s.newRuntime(metric)
+	if err != nil {
+		return nil, err
+	}
+	vu := &scriptVU{s: s, vm: vm, id: vm.ToValue(id)}
+	vu.request, _ = goja.AssertFunction(vm.Get("request"))
+	vu.check, _ = goja.AssertFunction(vm.Get("check"))
+	var data interface{}
+	_ = json.Unmarshal([]byte(s.data), &data)
+	vu.data = vm.ToValue(data)
+	return vu, nil
+}
+
+// next calls request() and sets req from its result, base holds the url, -H
+// and the other request flags.
+func (vu *scriptVU) next(base, req *fasthttp.Request) (string, error) {
+	iter := vu.iter
+	vu.iter++
+	v, err := vu.request(goja.Undefined(), vu.id, vu.vm.ToValue(iter), vu.data)
+	if err != nil {
+		return "", fmt.Errorf("script: request: %w", err)
+	}
+	base.CopyTo(req)
+
+	var spec map[string]interface{}
+	switch x := v.Export().(type) {
+	case string:
+		spec = map[string]interface{}{"url": x}
+	case map[string]interface{}:
+		spec = x
+	default:
+		return "", fmt.Errorf("script: request returned %s, want a url or an object", v)
+	}
+	label, _ := spec["label"].(string)
+	if m, ok := spec["method"].(string); ok && m != "" {
+		req.Header.SetMethod(strings.ToUpper(m))
+	}
+	if u, ok := spec["url"].(string); ok && u != "" {
+		ref, err := url2.Parse(u)
+		if err != nil {
+			return label, fmt.Errorf("script: %v", err)
+		}
+		target := vu.s.base.ResolveReference(ref)
+		if target.Scheme != vu.s.base.Scheme || target.Host != vu.s.base.Host {
+			return label, fmt.Errorf("script: url %s does not target %s://%s", target, vu.s.base.Scheme, vu.s.base.Host)
+		}
+		req.URI().SetPath(target.Path)
+		req.URI().SetQueryString(target.RawQuery)
+	}
+	if headers, ok := spec["headers"].(map[string]interface{}); ok {
+		for k, hv := range headers {
+			req.Header.Set(k, fmt.Sprint(hv))
+		}
+	}
+	switch body := spec["body"].(type) {
+	case nil:
+	case string:
+		req.SetBodyString(body)
+	default:
+		b, err := json.Marshal(body)
+		if err != nil {
+			return label, fmt.Errorf("script: body: %v", err)
+		}
+		req.SetBody(b)
+	}
+	return label, nil
+}
+
+// runCheck calls check(resp), an exception, false or a string fails the
+// request.
+func (vu *scriptVU) runCheck(resp *fasthttp.Response, rr *ReportRecord, label string) error {
+	headers := make(map[string]string)
+	for k, v := range resp.Header.All() {
+		headers[string(k)] = string(v)
+	}
+	obj := vu.vm.NewObject()
+	_ = obj.Set("status", resp.StatusCode())
+	_ = obj.Set("headers", headers)
+	_ = obj.Set("body", string(resp.Body()))
+	_ = obj.Set("latency", float64(rr.cost)/float64(time.Millisecond))
+	_ = obj.Set("label", label)
+	v, err := vu.check(goja.Undefined(), obj)
+	if err != nil {
+		return fmt.Errorf("script: check: %w", err)
+	}
+	switch x := v.Export().(type) {
+	case bool:
+		if !x {
+			return errors.New("script: check failed")
+		}
+	case string:
+		if x != "" {
+			return errors.New("script: check failed: " + x)
+		}
+	}
+	return nil
+}
+
+func isScriptInterrupted(err error) bool {
+	var interrupted *goja.InterruptedError
+	return errors.As(err, &interrupted)
+}
+
+// runScriptWorker is the worker loop of --script, the worker id is the vu
+// argument of request().
+func (r *Requester) runScriptWorker(ctx context.Context, cancel func(), limiter *rate.Limiter, semaphore *int64, id int) {
+	vu, err := r.script.newVU(id, func(name string, ms float64) {
+		rr := recordPool.Get().(*ReportRecord)
+		rr.cost = time.Duration(ms * float64(time.Millisecond))
+		rr.code = 0
+		rr.error = ""
+		rr.labelOnly = true
+		r.sendRecord(rr, scriptMetricPrefix+name, id)
+	})
+	if err != nil {
+		_, _ = r.errWriter.Write([]byte(fmt.Sprintf("\nscript: %v\n", err)))
+		return
+	}
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(scriptStopGrace, func() {
+			vu.vm.Interrupt(ctx.Err())
+		})
+	})
+	defer stop()
+
+	base := r.newRequest()
+	req := &fasthttp.Request{}
+	resp := &fasthttp.Response{}
+	jar := r.newCookieJar()
+	tr := r.newRequestTrace()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if !r.acquire(ctx, cancel, limiter, semaphore) {
+			continue
+		}
+
+		rr := recordPool.Get().(*ReportRecord)
+		label, err := vu.next(base, req)
+		if isScriptInterrupted(err) {
+			return
+		}
+		if err != nil {
+			rr.cost = 0
+			rr.code = 0
+			rr.error = err.Error()
+			r.sendRecord(rr, label, id)
+			continue
+		}
+		resp.Reset()
+		r.doRequest(req, resp, rr, jar, tr)
+		if rr.error == "" && vu.check != nil {
+			if err := vu.runCheck(resp, rr, label); isScriptInterrupted(err) {
+				return
+			} else if err != nil {
+				rr.error = err.Error()
+			}
+		}
+		r.sendRecord(rr, label, id)
+	}
+}
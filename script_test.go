@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func runScript(t *testing.T, url, script string, concurrency int, requests int64) (map[string][]*ReportRecord, []string) {
+	t.Helper()
+	requester, err := NewRequester(concurrency, requests, 0, nil, io.Discard, &ClientOpt{
+		url:         url,
+		method:      fasthttp.MethodGet,
+		headers:     []string{"X-Flag: on"},
+		scriptFile:  writeDataFile(t, "script.js", script),
+		maxConns:    concurrency,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string][]*ReportRecord{}
+	var errs []string
+	for _, rr := range collectRecords(t, requester) {
+		labels[rr.label] = append(labels[rr.label], rr)
+		if rr.error != "" {
+			errs = append(errs, rr.error)
+		}
+	}
+	return labels, errs
+}
+
+func startEchoServer(t *testing.T) (string, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []string
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		line := string(ctx.Method()) + " " + string(ctx.RequestURI()) + " " + string(ctx.Request.Header.Peek("X-Sig")) + " " + string(ctx.Request.Header.Peek("X-Flag")) + " " + string(ctx.PostBody())
+		mu.Lock()
+		got = append(got, line)
+		mu.Unlock()
+		ctx.Response.Header.Set("X-Echo", "yes")
+		ctx.SetBodyString(line)
+	})
+	return "http://" + addr, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), got...)
+	}
+}
+
+func TestScriptBuildsAndChecksRequests(t *testing.T) {
+	url, requests := startEchoServer(t)
+	labels, errs := runScript(t, url, `
+function setup() {
+	return {secret: "s3"};
+}
+
+function request(vu, iter, data) {
+	if (iter % 2 == 1) {
+		return "/items?vu=" + vu;
+	}
+	metric("sign", 1.5);
+	return {
+		method: "post",
+		url: "/orders/" + iter,
+		headers: {"X-Sig": data.secret + "-" + vu},
+		body: {vu: vu, iter: iter},
+		label: "order",
+	};
+}
+
+function check(resp) {
+	if (resp.status != 200 || resp.headers["X-Echo"] != "yes") {
+		return "unexpected response";
+	}
+	return resp.body.indexOf("X-Flag") < 0 && resp.latency >= 0;
+}
+`, 1, 8)
+	if len(errs) != 0 {
+		t.Fatalf("errors = %v, want none", errs)
+	}
+	if len(labels["order"]) != 4 || len(labels[""]) != 4 {
+		t.Fatalf("labels = %v, want 4 orders and 4 other requests", labels)
+	}
+	if m := labels[scriptMetricPrefix+"sign"]; len(m) != 4 || !m[0].labelOnly || m[0].cost != 1500*time.Microsecond {
+		t.Fatalf("metric records = %v, want 4 label only records of 1.5ms", m)
+	}
+
+	// a single worker runs the iterations in order
+	for i, line := range requests() {
+		if i%2 == 1 {
+			if line != "GET /items?vu=1  on " {
+				t.Fatalf("request #%d = %q, want GET /items", i, line)
+			}
+			continue
+		}
+		if want := fmt.Sprintf(`POST /orders/%d s3-1 on {"iter":%d,"vu":1}`, i, i); line != want {
+			t.Fatalf("request #%d = %q, want %q", i, line, want)
+		}
+	}
+}
+
+func TestScriptFailures(t *testing.T) {
+	url, _ := startEchoServer(t)
+	_, errs := runScript(t, url, `
+function request(vu, iter) {
+	if (iter == 0) {
+		throw new Error("no token");
+	}
+	return "/";
+}
+function check(resp) {
+	return false;
+}
+`, 1, 4)
+	var thrown, failed int
+	for _, e := range errs {
+		switch {
+		case strings.HasPrefix(e, "script: request: Error: no token"):
+			thrown++
+		case e == "script: check failed":
+			failed++
+		default:
+			t.Fatalf("unexpected error %q", e)
+		}
+	}
+	if thrown != 1 || failed != 3 {
+		t.Fatalf("errors = %v, want the first iteration to throw and 3 failed checks", errs)
+	}
+}
+
+func TestScriptUnderH2(t *testing.T) {
+	handler := &h2TestHandler{}
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	requester, err := NewRequester(1, 3, 0, nil, io.Discard, &ClientOpt{
+		url:          server.URL,
+		method:       fasthttp.MethodGet,
+		scriptFile:   writeDataFile(t, "script.js", "function request(vu, iter) { return '/items/' + iter + '?vu=' + vu; }"),
+		insecure:     true,
+		h2:           true,
+		h2Conns:      1,
+		h2MaxStreams: 1,
+		dialTimeout:  time.Second,
+		doTimeout:    5 * time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rr := range collectRecords(t, requester) {
+		if rr.code != fasthttp.StatusOK || rr.error != "" {
+			t.Fatalf("record = code %d error %q, want 200", rr.code, rr.error)
+		}
+	}
+	if got := strings.Join(handler.paths, ","); got != "/items/0?vu=1,/items/1?vu=1,/items/2?vu=1" {
+		t.Fatalf("server got %s, want the urls of the script", got)
+	}
+}
+
+func TestScriptRejectsInvalidInput(t *testing.T) {
+	url, _ := startEchoServer(t)
+	for name, script := range map[string]string{
+		"syntax":     "function request( {",
+		"no request": "function check(resp) { return true; }",
+		"setup":      "function setup() { throw new Error('down'); }\nfunction request() { return '/'; }",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: url, scriptFile: writeDataFile(t, "script.js", script)}, -1)
+			if err == nil {
+				t.Fatal("NewRequester succeeded, want error")
+			}
+		})
+	}
+
+	script := writeDataFile(t, "script.js", "function request() { return '/'; }")
+	for _, opt := range []*ClientOpt{
+		{url: url + "{{seq}}", scriptFile: script},
+		{url: url, headers: []string{"X-Id: {{seq}}"}, scriptFile: script},
+		{url: url, bodyBytes: []byte("{{seq}}"), scriptFile: script},
+	} {
+		if _, err := NewRequester(1, 1, 0, nil, io.Discard, opt, -1); err == nil {
+			t.Fatal("NewRequester succeeded with templates and --script, want error")
+		}
+	}
+	for _, opt := range []*ClientOpt{
+		{url: url, bodyBytes: []byte("x"), scriptFile: script},
+		{url: url, bodyFile: script, scriptFile: script},
+	} {
+		if _, err := NewRequester(1, 1, 0, nil, io.Discard, opt, -1); err == nil {
+			t.Fatal("NewRequester succeeded with --body and --script, want error")
+		}
+	}
+
+	_, errs := runScript(t, url, `function request() { return "http://example.com/"; }`, 1, 1)
+	if len(errs) != 1 || !strings.Contains(errs[0], "does not target") {
+		t.Fatalf("errors = %v, want the url to be rejected", errs)
+	}
+}
+
+func TestScriptLoopIsStoppedWithTheRun(t *testing.T) {
+	url, _ := startEchoServer(t)
+	requester, err := NewRequester(1, -1, 200*time.Millisecond, nil, io.Discard, &ClientOpt{
+		url:        url,
+		scriptFile: writeDataFile(t, "script.js", "function request() { for (;;) {} }"),
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// collectRecords fails if the script keeps running after the run
+	collectRecords(t, requester)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// stageTick is how often the stage targets are applied.
+const stageTick = 100 * time.Millisecond
+
+// minStageRate stands in for a zero rate, a zero rate.Limiter can't be raised
+// again once a waiter has consumed its burst.
+const minStageRate = 1e-6
+
+// Stage is one step of a load profile: the value moves linearly from the
+// target of the previous stage, or 0, to Target over Duration. A zero
+// Duration jumps to Target at once.
+type Stage struct {
+	Duration time.Duration
+	Target   float64
+}
+
+// ParseStages parses a comma separated list of DURATION:TARGET, such as
+// 30s:10,1m:100,30s:100,30s:0.
+func ParseStages(s string) ([]Stage, error) {
+	var stages []Stage
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		n := strings.SplitN(item, ":", 2)
+		if len(n) != 2 {
+			return nil, fmt.Errorf("invalid stage %q, format is DURATION:TARGET, example: 30s:10,1m:100,30s:0", item)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(n[0]))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid stage duration %q", n[0])
+		}
+		target, err := strconv.ParseFloat(strings.TrimSpace(n[1]), 64)
+		if err != nil || target < 0 || math.IsInf(target, 0) || math.IsNaN(target) {
+			return nil, fmt.Errorf("invalid stage target %q", n[1])
+		}
+		stages = append(stages, Stage{Duration: d, Target: target})
+	}
+	return stages, nil
+}
+
+func stagesDuration(stages []Stage) time.Duration {
+	var total time.Duration
+	for _, s := range stages {
+		total += s.Duration
+	}
+	return total
+}
+
+// stageTarget returns the target at elapsed, the last target is kept once
+// all stages are done.
+func stageTarget(stages []Stage, elapsed time.Duration) float64 {
+	var prev float64
+	for _, s := range stages {
+		if elapsed < s.Duration {
+			return prev + (s.Target-prev)*float64(elapsed)/float64(s.Duration)
+		}
+		elapsed -= s.Duration
+		prev = s.Target
+	}
+	return prev
+}
+
+// waitStagedRate is limiter.Wait for a limit that changes while workers are
+// waiting: nobody waits longer than a tick before looking at the new limit.
+func waitStagedRate(ctx context.Context, limiter *rate.Limiter) bool {
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, stageTick)
+		err := limiter.Wait(waitCtx)
+		cancel()
+		if err == nil {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(stageTick):
+		}
+	}
+}
+
+// runStages drives the concurrency and rate of --stages and --rate-stages.
+// Workers beyond the concurrency target are cancelled and stop after their
+// current request, the run ends with the last stage.
+func (r *Requester) runStages(ctx context.Context, cancel func(), limiter *rate.Limiter, startWorker func(context.Context, int)) {
+	stages, rateStages := r.clientOpt.stages, r.clientOpt.rateStages
+	total := stagesDuration(stages)
+	if d := stagesDuration(rateStages); d > total {
+		total = d
+	}
+
+	var workers []context.CancelFunc
+	defer func() {
+		for _, c := range workers {
+			c()
+		}
+	}()
+	id := 0
+	setWorkers := func(target int) {
+		for len(workers) < target {
+			workerCtx, c := context.WithCancel(ctx)
+			workers = append(workers, c)
+			id++
+			startWorker(workerCtx, id)
+		}
+		for len(workers) > target {
+			workers[len(workers)-1]()
+			workers = workers[:len(workers)-1]
+		}
+		atomic.StoreInt64(&r.concurrencyCount, int64(target))
+	}
+	if len(stages) == 0 {
+		setWorkers(r.concurrency)
+	}
+
+	ticker := time.NewTicker(stageTick)
+	defer ticker.Stop()
+	startTime := time.Now()
+	for {
+		elapsed := time.Since(startTime)
+		if len(stages) > 0 {
+			setWorkers(int(math.Round(stageTarget(stages, elapsed))))
+		}
+		if len(rateStages) > 0 {
+			limiter.SetLimit(rate.Limit(math.Max(stageTarget(rateStages, elapsed), minStageRate)))
+		}
+		if elapsed >= total {
+			cancel()
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
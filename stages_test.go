@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/time/rate"
+)
+
+func TestParseStages(t *testing.T) {
+	got, err := ParseStages("30s:10, 1m:100,0s:5.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Stage{{30 * time.Second, 10}, {time.Minute, 100}, {0, 5.5}}
+	if len(got) != len(want) {
+		t.Fatalf("ParseStages() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ParseStages() = %v, want %v", got, want)
+		}
+	}
+	if d := stagesDuration(got); d != 90*time.Second {
+		t.Fatalf("stagesDuration() = %s, want 1m30s", d)
+	}
+
+	for _, s := range []string{"", "30s", "30s:", "x:10", "-1s:10", "30s:-1", "30s:ten", "30s:10,"} {
+		if _, err := ParseStages(s); err == nil {
+			t.Fatalf("ParseStages(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestStageTarget(t *testing.T) {
+	stages := []Stage{{10 * time.Second, 10}, {10 * time.Second, 10}, {0, 50}, {10 * time.Second, 0}}
+	tests := []struct {
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 0},
+		{5 * time.Second, 5},
+		{10 * time.Second, 10},
+		{15 * time.Second, 10},
+		{20 * time.Second, 50},
+		{25 * time.Second, 25},
+		{30 * time.Second, 0},
+		{time.Minute, 0},
+	}
+	for _, tt := range tests {
+		if got := stageTarget(stages, tt.elapsed); got != tt.want {
+			t.Fatalf("stageTarget(%s) = %v, want %v", tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func runStagedRequester(t *testing.T, opt *ClientOpt, reqRate *rate.Limit) (*Requester, []*ReportRecord) {
+	t.Helper()
+	opt.method = fasthttp.MethodGet
+	opt.maxConns = 10
+	opt.dialTimeout = time.Second
+	opt.doTimeout = time.Second
+	requester, err := NewRequester(1, -1, 0, reqRate, io.Discard, opt, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the workers stop after the last stage
+	return requester, collectRecords(t, requester)
+}
+
+func TestStagesRampConcurrencyUpAndDown(t *testing.T) {
+	url := "http://" + startServer(t, slowHandler(10*time.Millisecond)) + "/"
+	requester, records := runStagedRequester(t, &ClientOpt{
+		url:    url,
+		stages: []Stage{{0, 4}, {300 * time.Millisecond, 4}, {0, 1}, {300 * time.Millisecond, 1}},
+	}, nil)
+	if len(records) == 0 {
+		t.Fatal("no records")
+	}
+	seen := map[int]bool{}
+	for _, rr := range records {
+		if rr.code != fasthttp.StatusOK {
+			t.Fatalf("record = code %d error %q, want 200", rr.code, rr.error)
+		}
+		seen[rr.concurrencyCount] = true
+	}
+	if !seen[4] || !seen[1] {
+		t.Fatalf("records saw concurrency %v, want 4 then 1", seen)
+	}
+	if last := records[len(records)-1].concurrencyCount; last != 1 {
+		t.Fatalf("last record has concurrency %d, want 1", last)
+	}
+	if requester.concurrencyCount != 1 {
+		t.Fatalf("concurrencyCount = %d after the run, want 1", requester.concurrencyCount)
+	}
+}
+
+func TestRateStagesFollowTheTarget(t *testing.T) {
+	url := "http://" + startServer(t, slowHandler(0)) + "/"
+	_, records := runStagedRequester(t, &ClientOpt{
+		url:        url,
+		rateStages: []Stage{{0, 50}, {500 * time.Millisecond, 50}, {0, 0}, {500 * time.Millisecond, 0}},
+	}, nil)
+	// 25 requests in the first half, nothing once the rate drops to 0
+	if len(records) < 15 || len(records) > 35 {
+		t.Fatalf("got %d records, want about 25", len(records))
+	}
+}
+
+func TestStagesRejectInvalidOptions(t *testing.T) {
+	limit := rate.Limit(10)
+	stages := []Stage{{time.Second, 1}}
+	tests := []struct {
+		name    string
+		opt     *ClientOpt
+		reqRate *rate.Limit
+		rampUp  int
+	}{
+		{"open model", &ClientOpt{stages: stages, openModel: true}, &limit, -1},
+		{"ramp up", &ClientOpt{stages: stages}, nil, 2},
+		{"rate", &ClientOpt{rateStages: stages}, &limit, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opt.url = "http://127.0.0.1/"
+			if _, err := NewRequester(1, -1, 0, tt.reqRate, io.Discard, tt.opt, tt.rampUp); err == nil {
+				t.Fatal("NewRequester succeeded, want error")
+			}
+		})
+	}
+}
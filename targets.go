@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	url2 "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var targetsModes = []string{"round-robin", "random", "weighted", "least-inflight"}
+
+// Target is a host the requests are spread across, from the urls of the
+// command line or a line of --targets.
+type Target struct {
+	URL    string
+	Weight int
+}
+
+// LoadTargetsFile reads one "URL [WEIGHT]" target per line.
+func LoadTargetsFile(path string) ([]*Target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets []*Target
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0][0] == '#' {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: want URL [WEIGHT]", path, lineNo)
+		}
+		t := &Target{URL: fields[0], Weight: 1}
+		if len(fields) == 2 {
+			if t.Weight, err = strconv.Atoi(fields[1]); err != nil || t.Weight <= 0 {
+				return nil, fmt.Errorf("%s:%d: invalid weight %q", path, lineNo, fields[1])
+			}
+		}
+		targets = append(targets, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets found", path)
+	}
+	return targets, nil
+}
+
+type hostTarget struct {
+	label    string
+	weight   int
+	client   HTTPClient
+	req      fasthttp.Request
+	inflight int64
+}
+
+// TargetSet spreads the requests across the clients of several hosts, it
+// is the HTTPClient of the run and sends every request to the client of
+// its url.
+type TargetSet struct {
+	targets     []*hostTarget
+	byHost      map[string]*hostTarget // by scheme://host
+	mode        string
+	cursor      uint64
+	totalWeight int
+}
+
+func NewTargetSet(targets []*Target, mode string, opt *ClientOpt, r *int64, w *int64, cs *connStats) (*TargetSet, error) {
+	s := &TargetSet{mode: mode, byHost: make(map[string]*hostTarget)}
+	hosts := make(map[string]int)
+	urls := make([]*url2.URL, len(targets))
+	for i, t := range targets {
+		u, err := url2.Parse(t.URL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("target %s: want an http or https url", t.URL)
+		}
+		urls[i] = u
+		hosts[u.Host]++
+	}
+	for i, t := range targets {
+		u := urls[i]
+		o := *opt
+		o.url = t.URL
+		client, header, err := buildRequestClient(&o, r, w, cs)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %v", t.URL, err)
+		}
+		ht := &hostTarget{label: u.Host, weight: t.Weight, client: client}
+		if hosts[u.Host] > 1 {
+			// the targets only differ by their path
+			ht.label = t.URL
+		}
+		if ht.weight <= 0 {
+			ht.weight = 1
+		}
+		header.CopyTo(&ht.req.Header)
+		ht.req.URI().SetScheme(u.Scheme)
+		ht.req.URI().SetHost(u.Host)
+		// keep the Host header of --host
+		ht.req.UseHostHeader = true
+		// http and https targets of a host don't share their client
+		key := hostKey(u)
+		if other, ok := s.byHost[key]; ok {
+			ht.client = other.client
+		} else {
+			s.byHost[key] = ht
+		}
+		s.targets = append(s.targets, ht)
+		s.totalWeight += ht.weight
+	}
+	return s, nil
+}
+
+func (s *TargetSet) Len() int {
+	return len(s.targets)
+}
+
+func (s *TargetSet) Next() *hostTarget {
+	switch s.mode {
+	case "random":
+		return s.targets[rand.Intn(len(s.targets))]
+	case "weighted":
+		n := rand.Intn(s.totalWeight)
+		for _, t := range s.targets {
+			if n < t.weight {
+				return t
+			}
+			n -= t.weight
+		}
+	case "least-inflight":
+		// start from the next target so that the ties are spread
+		start := atomic.AddUint64(&s.cursor, 1) - 1
+		var best *hostTarget
+		var bestInflight int64
+		for i := range s.targets {
+			t := s.targets[(start+uint64(i))%uint64(len(s.targets))]
+			host, _ := s.lookup(t.req.URI())
+			n := atomic.LoadInt64(&host.inflight)
+			if best == nil || n < bestInflight {
+				best, bestInflight = t, n
+			}
+		}
+		return best
+	}
+	i := atomic.AddUint64(&s.cursor, 1) - 1
+	return s.targets[i%uint64(len(s.targets))]
+}
+
+// hostKey returns the scheme://host key of u in byHost, the host is
+// lowercased as fasthttp does.
+func hostKey(u *url2.URL) string {
+	return u.Scheme + "://" + strings.ToLower(u.Host)
+}
+
+// lookup returns the target the client of scheme://host belongs to.
+func (s *TargetSet) lookup(uri *fasthttp.URI) (*hostTarget, bool) {
+	var buf [64]byte
+	key := append(append(append(buf[:0], uri.Scheme()...), "://"...), uri.Host()...)
+	t, ok := s.byHost[string(key)]
+	return t, ok
+}
+
+func (s *TargetSet) target(req *fasthttp.Request) (*hostTarget, error) {
+	t, ok := s.lookup(req.URI())
+	if !ok {
+		return nil, fmt.Errorf("no target for host %s", req.URI().Host())
+	}
+	return t, nil
+}
+
+func (s *TargetSet) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return s.DoTimeout(req, resp, 0)
+}
+
+func (s *TargetSet) DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	t, err := s.target(req)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&t.inflight, 1)
+	defer atomic.AddInt64(&t.inflight, -1)
+	if timeout > 0 {
+		return t.client.DoTimeout(req, resp, timeout)
+	}
+	return t.client.Do(req, resp)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestLoadTargetsFile(t *testing.T) {
+	targets, err := LoadTargetsFile(writeDataFile(t, "targets.txt", "# backends\nhttp://10.0.0.1:8080/\n\nhttp://10.0.0.2:8080/  3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || *targets[0] != (Target{"http://10.0.0.1:8080/", 1}) || *targets[1] != (Target{"http://10.0.0.2:8080/", 3}) {
+		t.Fatalf("targets = %v", targets)
+	}
+
+	for name, content := range map[string]string{
+		"empty":  "# nothing\n",
+		"weight": "http://10.0.0.1:8080/ 0\n",
+		"fields": "http://10.0.0.1:8080/ 1 2\n",
+	} {
+		if _, err := LoadTargetsFile(writeDataFile(t, "targets.txt", content)); err == nil {
+			t.Fatalf("%s: LoadTargetsFile succeeded, want error", name)
+		}
+	}
+}
+
+func startTargetServer(t *testing.T, mu *sync.Mutex, got map[string][]string) string {
+	t.Helper()
+	return startServer(t, func(ctx *fasthttp.RequestCtx) {
+		addr := ctx.LocalAddr().String()
+		mu.Lock()
+		got[addr] = append(got[addr], string(ctx.Host())+string(ctx.RequestURI())+" "+string(ctx.PostBody()))
+		mu.Unlock()
+	})
+}
+
+func TestTargetsSpreadRequests(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]string{}
+	a, b := startTargetServer(t, &mu, got), startTargetServer(t, &mu, got)
+	requester, err := NewRequester(2, 10, 0, nil, io.Discard, &ClientOpt{
+		url:         "http://" + a + "/a",
+		method:      fasthttp.MethodPost,
+		bodyBytes:   []byte("x"),
+		host:        "api.example.com",
+		targets:     []*Target{{URL: "http://" + a + "/a"}, {URL: "http://" + b + "/b"}},
+		targetsMode: "round-robin",
+		maxConns:    2,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]int{}
+	for _, rr := range collectRecords(t, requester) {
+		if rr.code != fasthttp.StatusOK {
+			t.Fatalf("record = code %d error %q, want 200", rr.code, rr.error)
+		}
+		labels[rr.label]++
+	}
+	if labels[a] != 5 || labels[b] != 5 {
+		t.Fatalf("labels = %v, want 5 requests per host", labels)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for addr, path := range map[string]string{a: "/a", b: "/b"} {
+		for _, line := range got[addr] {
+			if line != "api.example.com"+path+" x" {
+				t.Fatalf("%s got %q, want the --host header, its path and the body", addr, line)
+			}
+		}
+	}
+}
+
+func TestTargetSetModes(t *testing.T) {
+	targets := []*Target{{URL: "http://127.0.0.1:1/", Weight: 1}, {URL: "http://127.0.0.2:1/", Weight: 3}, {URL: "http://127.0.0.2:1/other", Weight: 1}}
+	s, err := NewTargetSet(targets, "weighted", &ClientOpt{method: fasthttp.MethodGet}, new(int64), new(int64), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.targets[0].label != "127.0.0.1:1" || s.targets[1].label != "http://127.0.0.2:1/" || s.targets[1].client != s.targets[2].client {
+		t.Fatal("the targets of a host should share its client and be labeled by url")
+	}
+	counts := map[*hostTarget]int{}
+	for i := 0; i < 5000; i++ {
+		counts[s.Next()]++
+	}
+	if c := counts[s.targets[1]]; c < 2500 || c > 3500 {
+		t.Fatalf("the weight 3 target got %d of 5000 requests, want about 3000", c)
+	}
+
+	s.mode = "least-inflight"
+	s.byHost["http://127.0.0.1:1"].inflight = 2
+	s.byHost["http://127.0.0.2:1"].inflight = 1
+	for i := 0; i < 4; i++ {
+		if host := string(s.Next().req.URI().Host()); host != "127.0.0.2:1" {
+			t.Fatalf("picked %s, want the host with the least requests in flight", host)
+		}
+	}
+}
+
+func TestTargetSetKeepsSchemesApart(t *testing.T) {
+	targets := []*Target{{URL: "http://127.0.0.1:1/"}, {URL: "https://127.0.0.1:1/"}}
+	s, err := NewTargetSet(targets, "round-robin", &ClientOpt{method: fasthttp.MethodGet}, new(int64), new(int64), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.targets[0].client == s.targets[1].client {
+		t.Fatal("the http and https targets of a host share a client")
+	}
+	for _, ht := range s.targets {
+		if got, err := s.target(&ht.req); err != nil || got != ht {
+			t.Fatalf("target(%s) = %v %v, want its own target", ht.req.URI(), got, err)
+		}
+	}
+}
+
+func TestTargetsRejectsOtherModes(t *testing.T) {
+	targets := []*Target{{URL: "http://127.0.0.1:1/"}, {URL: "http://127.0.0.2:1/"}}
+	for name, opt := range map[string]*ClientOpt{
+		"requests file": {url: targets[0].URL, targets: targets, requestsFile: "requests.jsonl"},
+		"h2":            {url: targets[0].URL, targets: targets, h2: true},
+		"template":      {url: targets[0].URL, targets: []*Target{targets[0], {URL: "http://127.0.0.2:1/{{seq}}"}}},
+	} {
+		if _, err := NewRequester(1, 1, 0, nil, io.Discard, opt, -1); err == nil {
+			t.Fatalf("%s: NewRequester succeeded, want error", name)
+		}
+	}
+}
+
+func TestTargetSetFindsMixedCaseHosts(t *testing.T) {
+	targets := []*Target{{URL: "http://Example.COM:1/"}, {URL: "http://127.0.0.1:1/"}}
+	s, err := NewTargetSet(targets, "round-robin", &ClientOpt{method: fasthttp.MethodGet}, new(int64), new(int64), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.target(&s.targets[0].req); err != nil || got != s.targets[0] {
+		t.Fatalf("target(%s) = %v %v, want the mixed case target", s.targets[0].req.URI(), got, err)
+	}
+}
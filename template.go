@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/valyala/fasthttp"
+)
+
+// templateFunc appends the value of one {{...}} expression to dst.
+type templateFunc func(dst []byte, ts *templateState) []byte
+
+type templatePart struct {
+	literal []byte
+	fn      templateFunc
+}
+
+// Template is a string with {{...}} expressions compiled once, executing it
+// only appends to a buffer owned by the worker.
+type Template struct {
+	parts []templatePart
+}
+
+func (t *Template) Execute(dst []byte, ts *templateState) []byte {
+	for _, p := range t.parts {
+		if p.fn != nil {
+			dst = p.fn(dst, ts)
+		} else {
+			dst = append(dst, p.literal...)
+		}
+	}
+	return dst
+}
+
+func hasTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// csvFile is a file read by {{csv}}, its rows are used in turn by all
+// workers.
+type csvFile struct {
+	index  int
+	header map[string]int
+	rows   [][]string
+	cursor uint64
+}
+
+// templateContext is shared by the templates of a run.
+type templateContext struct {
+	seq      int64
+	files    map[string]*csvFile
+	data     *DataSet
+	usesData bool
+}
+
+func newTemplateContext(data *DataSet) *templateContext {
+	return &templateContext{files: map[string]*csvFile{}, data: data}
+}
+
+// requestTemplates are the templated parts of a request.
+type requestTemplates struct {
+	ctx     *templateContext
+	uri     *Template
+	headers []headerTemplate
+	body    *Template
+}
+
+type headerTemplate struct {
+	key   []byte
+	value *Template
+}
+
+// templateState is the per worker state of the templates, expressions
+// of the same request share one {{seq}}, {{now}} and csv row. The --data row
+// and the {{var}} variables are kept until the worker moves on.
+type templateState struct {
+	ctx     *templateContext
+	rand    *rand.Rand
+	seq     int64
+	now     time.Time
+	csvRows []int
+	dataRow []string
+	vars    map[string]string
+	buf     []byte
+}
+
+// newRequestTemplates compiles the templates of the url, -H and --body
+// flags, it returns nil when the request is static.
+func newRequestTemplates(opt *ClientOpt) (*requestTemplates, error) {
+	c := newTemplateContext(opt.data)
+	var uri string
+	if hasTemplate(opt.url) {
+		i := strings.Index(opt.url, "://")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid url %q", opt.url)
+		}
+		j := strings.IndexAny(opt.url[i+3:], "/?")
+		if j < 0 || hasTemplate(opt.url[:i+3+j]) {
+			return nil, errors.New("templates are only supported in the path and query of the url")
+		}
+		uri = opt.url[i+3+j:]
+	}
+	rt, err := c.compileRequest(uri, opt.headers, string(opt.bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	if opt.data != nil && !c.usesData {
+		return nil, errors.New(`--data requires {{data "COLUMN"}} in the url, a header or the body`)
+	}
+	return rt, nil
+}
+
+// compileRequest compiles the templated parts of a request uri, "K: V"
+// headers and body, it returns nil when none of them is templated.
+func (c *templateContext) compileRequest(uri string, headers []string, body string) (*requestTemplates, error) {
+	rt := &requestTemplates{ctx: c}
+	found := false
+	if hasTemplate(uri) {
+		if uri[0] == '?' {
+			uri = "/" + uri
+		}
+		t, err := c.compile(uri)
+		if err != nil {
+			return nil, fmt.Errorf("url: %v", err)
+		}
+		rt.uri = t
+		found = true
+	}
+	for _, h := range headers {
+		n := strings.SplitN(h, ":", 2)
+		if len(n) != 2 || !hasTemplate(n[1]) {
+			continue
+		}
+		t, err := c.compile(strings.TrimSpace(n[1]))
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %v", strings.TrimSpace(n[0]), err)
+		}
+		rt.headers = append(rt.headers, headerTemplate{key: []byte(strings.TrimSpace(n[0])), value: t})
+		found = true
+	}
+	if hasTemplate(body) {
+		t, err := c.compile(body)
+		if err != nil {
+			return nil, fmt.Errorf("body: %v", err)
+		}
+		rt.body = t
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return rt, nil
+}
+
+func (c *templateContext) newState() *templateState {
+	return &templateState{
+		ctx:     c,
+		rand:    rand.New(rand.NewSource(rand.Int63())),
+		csvRows: make([]int, len(c.files)),
+		vars:    map[string]string{},
+	}
+}
+
+// nextRow moves the worker to the next row of --data.
+func (ts *templateState) nextRow() error {
+	if ts.ctx.data == nil {
+		return nil
+	}
+	row, err := ts.ctx.data.Next(ts.rand)
+	if err != nil {
+		return err
+	}
+	ts.dataRow = row
+	return nil
+}
+
+// apply evaluates the templates into req.
+func (rt *requestTemplates) apply(req *fasthttp.Request, ts *templateState) {
+	ts.seq = 0
+	ts.now = time.Time{}
+	for i := range ts.csvRows {
+		ts.csvRows[i] = -1
+	}
+	if rt.uri != nil {
+		ts.buf = rt.uri.Execute(ts.buf[:0], ts)
+		path, query := ts.buf, []byte(nil)
+		if i := bytes.IndexByte(ts.buf, '?'); i >= 0 {
+			path, query = ts.buf[:i], ts.buf[i+1:]
+		}
+		req.URI().SetPathBytes(path)
+		req.URI().SetQueryStringBytes(query)
+	}
+	for _, h := range rt.headers {
+		ts.buf = h.value.Execute(ts.buf[:0], ts)
+		req.Header.SetBytesKV(h.key, ts.buf)
+	}
+	if rt.body != nil {
+		ts.buf = rt.body.Execute(ts.buf[:0], ts)
+		req.SetBody(ts.buf)
+	}
+}
+
+func (c *templateContext) compile(s string) (*Template, error) {
+	t := &Template{}
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(s[i:], "}}")
+		if j < 0 {
+			return nil, fmt.Errorf("unclosed template %q", s[i:])
+		}
+		if i > 0 {
+			t.parts = append(t.parts, templatePart{literal: []byte(s[:i])})
+		}
+		fn, err := c.compileExpr(s[i+2 : i+j])
+		if err != nil {
+			return nil, fmt.Errorf("{{%s}}: %v", s[i+2:i+j], err)
+		}
+		t.parts = append(t.parts, templatePart{fn: fn})
+		s = s[i+j+2:]
+	}
+	if s != "" {
+		t.parts = append(t.parts, templatePart{literal: []byte(s)})
+	}
+	return t, nil
+}
+
+// splitTemplateArgs splits an expression into words, double quoted words
+// may contain spaces.
+func splitTemplateArgs(expr string) ([]string, error) {
+	var args []string
+	expr = strings.TrimSpace(expr)
+	for expr != "" {
+		if expr[0] == '"' {
+			arg, err := strconv.QuotedPrefix(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", expr)
+			}
+			v, _ := strconv.Unquote(arg)
+			args = append(args, v)
+			expr = expr[len(arg):]
+		} else {
+			i := strings.IndexFunc(expr, unicode.IsSpace)
+			if i < 0 {
+				i = len(expr)
+			}
+			args = append(args, expr[:i])
+			expr = expr[i:]
+		}
+		if expr != "" && !unicode.IsSpace(rune(expr[0])) {
+			return nil, fmt.Errorf("missing space before %s", expr)
+		}
+		expr = strings.TrimSpace(expr)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty template")
+	}
+	return args, nil
+}
+
+func (c *templateContext) compileExpr(expr string) (templateFunc, error) {
+	args, err := splitTemplateArgs(expr)
+	if err != nil {
+		return nil, err
+	}
+	name, args := args[0], args[1:]
+	intArgs := func(n int) ([]int64, error) {
+		if len(args) != n {
+			return nil, fmt.Errorf("%s takes %d argument(s)", name, n)
+		}
+		v := make([]int64, n)
+		for i, a := range args {
+			if v[i], err = strconv.ParseInt(a, 10, 64); err != nil {
+				return nil, fmt.Errorf("%s: invalid number %q", name, a)
+			}
+		}
+		return v, nil
+	}
+
+	switch name {
+	case "uuid":
+		if len(args) != 0 {
+			return nil, errors.New("uuid takes no argument")
+		}
+		return appendUUID, nil
+	case "seq":
+		if len(args) != 0 {
+			return nil, errors.New("seq takes no argument")
+		}
+		return func(dst []byte, ts *templateState) []byte {
+			if ts.seq == 0 {
+				ts.seq = atomic.AddInt64(&c.seq, 1)
+			}
+			return strconv.AppendInt(dst, ts.seq, 10)
+		}, nil
+	case "randInt":
+		v, err := intArgs(2)
+		if err != nil {
+			return nil, err
+		}
+		lo, hi := v[0], v[1]
+		if lo > hi {
+			return nil, fmt.Errorf("randInt: %d is greater than %d", lo, hi)
+		}
+		return func(dst []byte, ts *templateState) []byte {
+			return strconv.AppendInt(dst, lo+ts.rand.Int63n(hi-lo+1), 10)
+		}, nil
+	case "randomString":
+		v, err := intArgs(1)
+		if err != nil {
+			return nil, err
+		}
+		n := int(v[0])
+		if n <= 0 {
+			return nil, errors.New("randomString: length must be positive")
+		}
+		return func(dst []byte, ts *templateState) []byte {
+			for i := 0; i < n; i++ {
+				dst = append(dst, randomStringChars[ts.rand.Intn(len(randomStringChars))])
+			}
+			return dst
+		}, nil
+	case "now":
+		if len(args) > 1 {
+			return nil, errors.New("now takes at most 1 argument")
+		}
+		layout := time.RFC3339
+		if len(args) == 1 {
+			layout = args[0]
+		}
+		return func(dst []byte, ts *templateState) []byte {
+			if ts.now.IsZero() {
+				ts.now = time.Now()
+			}
+			switch layout {
+			case "unix":
+				return strconv.AppendInt(dst, ts.now.Unix(), 10)
+			case "unixms":
+				return strconv.AppendInt(dst, ts.now.UnixMilli(), 10)
+			}
+			return ts.now.AppendFormat(dst, layout)
+		}, nil
+	case "csv":
+		if len(args) != 2 {
+			return nil, errors.New("csv takes 2 arguments, a file and a column")
+		}
+		f, err := c.loadCSV(args[0])
+		if err != nil {
+			return nil, err
+		}
+		col, ok := f.header[args[1]]
+		if !ok {
+			return nil, fmt.Errorf("%s has no column %q", args[0], args[1])
+		}
+		return func(dst []byte, ts *templateState) []byte {
+			row := ts.csvRows[f.index]
+			if row < 0 {
+				row = int((atomic.AddUint64(&f.cursor, 1) - 1) % uint64(len(f.rows)))
+				ts.csvRows[f.index] = row
+			}
+			if cells := f.rows[row]; col < len(cells) {
+				dst = append(dst, cells[col]...)
+			}
+			return dst
+		}, nil
+	case "data":
+		if len(args) != 1 {
+			return nil, errors.New("data takes 1 argument, a column")
+		}
+		if c.data == nil {
+			return nil, errors.New("data requires --data")
+		}
+		col, ok := c.data.columns[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("--data has no column %q", args[0])
+		}
+		c.usesData = true
+		return func(dst []byte, ts *templateState) []byte {
+			if col < len(ts.dataRow) {
+				dst = append(dst, ts.dataRow[col]...)
+			}
+			return dst
+		}, nil
+	case "var":
+		if len(args) != 1 {
+			return nil, errors.New("var takes 1 argument, a --scenario variable")
+		}
+		v := args[0]
+		return func(dst []byte, ts *templateState) []byte {
+			return append(dst, ts.vars[v]...)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown function %q", name)
+}
+
+const randomStringChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func appendUUID(dst []byte, ts *templateState) []byte {
+	const hex = "0123456789abcdef"
+	var b [16]byte
+	hi, lo := ts.rand.Uint64(), ts.rand.Uint64()
+	for i := 0; i < 8; i++ {
+		b[i] = byte(hi >> (8 * i))
+		b[8+i] = byte(lo >> (8 * i))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	for i, c := range b {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			dst = append(dst, '-')
+		}
+		dst = append(dst, hex[c>>4], hex[c&0x0f])
+	}
+	return dst
+}
+
+// loadCSV reads a csv file with a header line, files are read once however
+// many expressions use them.
+func (c *templateContext) loadCSV(path string) (*csvFile, error) {
+	if f, ok := c.files[path]; ok {
+		return f, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s: a header line and at least one row are required", path)
+	}
+	f := &csvFile{index: len(c.files), header: map[string]int{}, rows: records[1:]}
+	for i, name := range records[0] {
+		f.header[strings.TrimSpace(name)] = i
+	}
+	c.files[path] = f
+	return f, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func executeTemplate(t *testing.T, c *templateContext, s string) string {
+	t.Helper()
+	tmpl, err := c.compile(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := c.newState()
+	for i := range ts.csvRows {
+		ts.csvRows[i] = -1
+	}
+	return string(tmpl.Execute(nil, ts))
+}
+
+func TestTemplateFunctions(t *testing.T) {
+	c := newTemplateContext(nil)
+
+	uuid := regexp.MustCompile(`^id=[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if got := executeTemplate(t, c, "id={{uuid}}"); !uuid.MatchString(got) {
+		t.Fatalf("uuid = %q, want a version 4 UUID", got)
+	}
+
+	for i := 0; i < 100; i++ {
+		got := executeTemplate(t, c, "{{ randInt -2 2 }}")
+		if n, err := strconv.Atoi(got); err != nil || n < -2 || n > 2 {
+			t.Fatalf("randInt -2 2 = %q, want a number in [-2, 2]", got)
+		}
+	}
+
+	if got := executeTemplate(t, c, "{{randomString 16}}"); !regexp.MustCompile(`^[a-zA-Z0-9]{16}$`).MatchString(got) {
+		t.Fatalf("randomString 16 = %q, want 16 letters or digits", got)
+	}
+
+	if got := executeTemplate(t, c, "{{seq}}-{{seq}}"); got != "1-1" {
+		t.Fatalf("seq = %q, want one number per request", got)
+	}
+	if got := executeTemplate(t, c, "{{seq}}"); got != "2" {
+		t.Fatalf("seq = %q, want 2", got)
+	}
+
+	before := time.Now().Unix()
+	got := executeTemplate(t, c, "{{now \"unix\"}}")
+	if n, err := strconv.ParseInt(got, 10, 64); err != nil || n < before || n > time.Now().Unix() {
+		t.Fatalf("now unix = %q, want the current time", got)
+	}
+	if got := executeTemplate(t, c, "{{now}}"); !regexp.MustCompile(`^\d{4}-\d\d-\d\dT`).MatchString(got) {
+		t.Fatalf("now = %q, want RFC3339", got)
+	}
+	if got := executeTemplate(t, c, `{{now "2006"}}`); got != strconv.Itoa(time.Now().Year()) {
+		t.Fatalf("now 2006 = %q, want the year", got)
+	}
+}
+
+func TestTemplateCSVRowsInTurn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(path, []byte("id,name\n1,alice\n2,bob\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTemplateContext(nil)
+	rt, err := c.compileRequest("", nil, `{{csv "`+path+`" "id"}}:{{csv "`+path+`" "name"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.files) != 1 {
+		t.Fatalf("%d csv files loaded, want 1", len(c.files))
+	}
+	ts := c.newState()
+	var got []string
+	for i := 0; i < 3; i++ {
+		req := fasthttp.AcquireRequest()
+		rt.apply(req, ts)
+		got = append(got, string(req.Body()))
+		fasthttp.ReleaseRequest(req)
+	}
+	if strings.Join(got, " ") != "1:alice 2:bob 1:alice" {
+		t.Fatalf("csv rows = %v, want each row in turn", got)
+	}
+}
+
+func TestTemplateCompileErrors(t *testing.T) {
+	for _, s := range []string{
+		"{{uuid",
+		"{{}}",
+		"{{nope}}",
+		"{{uuid 1}}",
+		"{{randInt 1}}",
+		"{{randInt 5 1}}",
+		"{{randInt a 1}}",
+		"{{randomString 0}}",
+		`{{now "a" "b"}}`,
+		`{{csv "missing.csv" "id"}}`,
+		`{{csv "unclosed}}`,
+	} {
+		if _, err := newTemplateContext(nil).compile(s); err == nil {
+			t.Fatalf("compile(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestNewRequestTemplates(t *testing.T) {
+	rt, err := newRequestTemplates(&ClientOpt{url: "http://127.0.0.1/static", headers: []string{"X-A: b"}, bodyBytes: []byte("{}")})
+	if err != nil || rt != nil {
+		t.Fatalf("newRequestTemplates() = %v, %v, want nil for a static request", rt, err)
+	}
+	if _, err := newRequestTemplates(&ClientOpt{url: "http://{{uuid}}.example.com/"}); err == nil {
+		t.Fatal("newRequestTemplates() accepted a templated host")
+	}
+	if _, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: "ws://127.0.0.1/{{seq}}"}, -1); err == nil {
+		t.Fatal("NewRequester() accepted templates with a websocket url")
+	}
+}
+
+func TestRequesterEvaluatesTemplatesPerRequest(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		got = append(got, string(ctx.RequestURI())+" "+string(ctx.Request.Header.Peek("X-Request-Id"))+" "+string(ctx.PostBody()))
+		mu.Unlock()
+	})
+
+	requester, err := NewRequester(2, 10, 0, nil, io.Discard, &ClientOpt{
+		url:         "http://" + addr + "/users/{{seq}}?n={{seq}}",
+		method:      fasthttp.MethodPost,
+		headers:     []string{"X-Request-Id: {{seq}}"},
+		bodyBytes:   []byte(`{"id": {{seq}}}`),
+		maxConns:    2,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range collectRecords(t, requester) {
+		if record.code != fasthttp.StatusOK {
+			t.Fatalf("record = code %d error %q, want 200", record.code, record.error)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 10 {
+		t.Fatalf("server got %d requests, want 10", len(got))
+	}
+	seen := map[string]bool{}
+	for _, g := range got {
+		n, _, _ := strings.Cut(strings.TrimPrefix(g, "/users/"), "?")
+		if want := "/users/" + n + "?n=" + n + " " + n + ` {"id": ` + n + "}"; g != want {
+			t.Fatalf("request = %q, want %q", g, want)
+		}
+		seen[g] = true
+	}
+	if len(seen) != 10 {
+		t.Fatalf("requests = %v, want 10 different ones", got)
+	}
+}
+
+func TestRequesterEvaluatesTemplatesWithBodyFile(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	addr := startServer(t, func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		got = append(got, string(ctx.RequestURI())+" "+string(ctx.Request.Header.Peek("X-Request-Id"))+" "+string(ctx.PostBody()))
+		mu.Unlock()
+	})
+
+	requester, err := NewRequester(1, 3, 0, nil, io.Discard, &ClientOpt{
+		url:         "http://" + addr + "/users/{{seq}}",
+		method:      fasthttp.MethodPost,
+		headers:     []string{"X-Request-Id: {{seq}}"},
+		bodyFile:    writeDataFile(t, "body.json", `{"id": "{{seq}}"}`),
+		maxConns:    1,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range collectRecords(t, requester) {
+		if record.code != fasthttp.StatusOK {
+			t.Fatalf("record = code %d error %q, want 200", record.code, record.error)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the streamed body is sent as is
+	want := []string{`/users/1 1 {"id": "{{seq}}"}`, `/users/2 2 {"id": "{{seq}}"}`, `/users/3 3 {"id": "{{seq}}"}`}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("requests = %q, want %q", got, want)
+	}
+}
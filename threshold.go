@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	thresholdNumber = iota
+	thresholdDuration
+	thresholdRatio
+)
+
+var thresholdOps = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// Threshold is a pass/fail condition checked against the final report,
+// such as p99<250ms, rps>1000, error_rate<0.1% or 5xx<10.
+type Threshold struct {
+	expr   string
+	metric string
+	op     string
+	value  float64
+	kind   int
+}
+
+type ThresholdResult struct {
+	*Threshold
+	Actual float64
+	Pass   bool
+}
+
+func isLatencyMetric(metric string) bool {
+	switch metric {
+	case "min", "mean", "stddev", "max":
+		return true
+	}
+	return strings.HasPrefix(metric, "p")
+}
+
+func isCountMetric(metric string) bool {
+	switch metric {
+	case "count", "errors", "dropped", "late", "1xx", "2xx", "3xx", "4xx", "5xx":
+		return true
+	}
+	return false
+}
+
+func ParseThreshold(expr string) (*Threshold, error) {
+	t := &Threshold{expr: expr}
+	for _, op := range thresholdOps {
+		if i := strings.Index(expr, op); i > 0 {
+			t.metric = strings.ToLower(strings.TrimSpace(expr[:i]))
+			t.op = op
+			expr = strings.TrimSpace(expr[i+len(op):])
+			break
+		}
+	}
+	if t.op == "" || expr == "" {
+		return nil, fmt.Errorf("invalid threshold %q, examples: p99<250ms, rps>1000, error_rate<0.1%%, 5xx<10", t.expr)
+	}
+
+	var err error
+	switch {
+	case t.metric == "rps":
+		t.kind = thresholdNumber
+		t.value, err = strconv.ParseFloat(expr, 64)
+	case t.metric == "error_rate" || (isCountMetric(t.metric) && strings.HasSuffix(expr, "%")):
+		t.kind = thresholdRatio
+		if strings.HasSuffix(expr, "%") {
+			t.value, err = strconv.ParseFloat(strings.TrimSuffix(expr, "%"), 64)
+			t.value /= 100
+		} else {
+			t.value, err = strconv.ParseFloat(expr, 64)
+		}
+	case isCountMetric(t.metric):
+		t.kind = thresholdNumber
+		t.value, err = strconv.ParseFloat(expr, 64)
+	case isLatencyMetric(t.metric):
+		if strings.HasPrefix(t.metric, "p") && !percentileExists(t.metric) {
+			return nil, fmt.Errorf("invalid threshold %q: unknown percentile %s", t.expr, t.metric)
+		}
+		t.kind = thresholdDuration
+		var d time.Duration
+		d, err = time.ParseDuration(expr)
+		t.value = float64(d)
+	default:
+		return nil, fmt.Errorf("invalid threshold %q: unknown metric %s", t.expr, t.metric)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid threshold %q: %v", t.expr, err)
+	}
+	return t, nil
+}
+
+func percentileExists(metric string) bool {
+	for _, p := range quantiles {
+		if metric == "p"+formatFloat64(p*100) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Threshold) actual(snapshot *SnapshotReport) float64 {
+	var errors int64
+	for _, v := range snapshot.Errors {
+		errors += v
+	}
+	var n float64
+	switch t.metric {
+	case "rps":
+		return snapshot.RPS
+	case "min":
+		return float64(snapshot.Stats.Min)
+	case "mean":
+		return float64(snapshot.Stats.Mean)
+	case "stddev":
+		return float64(snapshot.Stats.StdDev)
+	case "max":
+		return float64(snapshot.Stats.Max)
+	case "count":
+		n = float64(snapshot.Count)
+	case "errors", "error_rate":
+		n = float64(errors)
+	case "dropped":
+		n = float64(snapshot.Dropped)
+	case "late":
+		n = float64(snapshot.Late)
+	case "1xx", "2xx", "3xx", "4xx", "5xx":
+		n = float64(snapshot.Codes[t.metric])
+	default:
+		for _, p := range snapshot.Percentiles {
+			if t.metric == "p"+formatFloat64(p.Percentile*100) {
+				return float64(p.Latency)
+			}
+		}
+		return 0
+	}
+	if t.kind == thresholdRatio {
+		if snapshot.Count == 0 {
+			return 0
+		}
+		return n / float64(snapshot.Count)
+	}
+	return n
+}
+
+func (t *Threshold) Check(snapshot *SnapshotReport) *ThresholdResult {
+	v := t.actual(snapshot)
+	var pass bool
+	switch t.op {
+	case "<":
+		pass = v < t.value
+	case "<=":
+		pass = v <= t.value
+	case ">":
+		pass = v > t.value
+	case ">=":
+		pass = v >= t.value
+	case "==":
+		pass = v == t.value
+	case "!=":
+		pass = v != t.value
+	}
+	return &ThresholdResult{Threshold: t, Actual: v, Pass: pass}
+}
+
+func (r *ThresholdResult) ActualString(useSeconds bool) string {
+	switch r.kind {
+	case thresholdDuration:
+		return durationToString(time.Duration(r.Actual), useSeconds)
+	case thresholdRatio:
+		return formatFloat64(float64(int64(r.Actual*1e6+0.5))/1e4) + "%"
+	}
+	if r.metric == "rps" {
+		return fmt.Sprintf("%.3f", r.Actual)
+	}
+	return formatFloat64(r.Actual)
+}
+
+func CheckThresholds(thresholds []*Threshold, snapshot *SnapshotReport) (results []*ThresholdResult, failed int) {
+	for _, t := range thresholds {
+		r := t.Check(snapshot)
+		if !r.Pass {
+			failed++
+		}
+		results = append(results, r)
+	}
+	return
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		expr   string
+		metric string
+		op     string
+		value  float64
+		kind   int
+	}{
+		{"p99<250ms", "p99", "<", float64(250 * time.Millisecond), thresholdDuration},
+		{"P99.9 <= 1s", "p99.9", "<=", float64(time.Second), thresholdDuration},
+		{"mean<20ms", "mean", "<", float64(20 * time.Millisecond), thresholdDuration},
+		{"rps>1000", "rps", ">", 1000, thresholdNumber},
+		{"error_rate<0.1%", "error_rate", "<", 0.001, thresholdRatio},
+		{"error_rate<0.01", "error_rate", "<", 0.01, thresholdRatio},
+		{"5xx<10", "5xx", "<", 10, thresholdNumber},
+		{"4xx<=5%", "4xx", "<=", 0.05, thresholdRatio},
+		{"count>=100", "count", ">=", 100, thresholdNumber},
+		{"errors==0", "errors", "==", 0, thresholdNumber},
+		{"dropped==0", "dropped", "==", 0, thresholdNumber},
+		{"late<1%", "late", "<", 0.01, thresholdRatio},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := ParseThreshold(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.metric != tt.metric || got.op != tt.op || got.kind != tt.kind {
+				t.Fatalf("ParseThreshold(%q) = %s %s kind %d, want %s %s kind %d", tt.expr, got.metric, got.op, got.kind, tt.metric, tt.op, tt.kind)
+			}
+			if diff := got.value - tt.value; diff > 1e-9 || diff < -1e-9 {
+				t.Fatalf("ParseThreshold(%q).value = %v, want %v", tt.expr, got.value, tt.value)
+			}
+		})
+	}
+}
+
+func TestParseThresholdRejectsInvalidInput(t *testing.T) {
+	for _, expr := range []string{"", "p99", "<250ms", "p99<", "p98<1s", "latency<1s", "p99<250", "rps>fast", "5xx<ten"} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseThreshold(expr); err == nil {
+				t.Fatalf("ParseThreshold(%q) succeeded, want error", expr)
+			}
+		})
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	snapshot := testSnapshotReport()
+	tests := []struct {
+		expr   string
+		pass   bool
+		actual string
+	}{
+		{"p99<30ms", true, "29ms"},
+		{"p50>15ms", false, "15ms"},
+		{"max<=30ms", true, "30ms"},
+		{"rps>1", true, "2.000"},
+		{"error_rate<10%", false, "33.3333%"},
+		{"5xx<1", false, "1"},
+		{"2xx>=2", true, "2"},
+		{"count==3", true, "3"},
+		{"errors!=0", true, "1"},
+	}
+	var thresholds []*Threshold
+	for _, tt := range tests {
+		th, err := ParseThreshold(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thresholds = append(thresholds, th)
+	}
+
+	results, failed := CheckThresholds(thresholds, snapshot)
+	if failed != 3 {
+		t.Fatalf("failed = %d, want 3", failed)
+	}
+	for i, tt := range tests {
+		if results[i].Pass != tt.pass {
+			t.Fatalf("%s pass = %v, want %v", tt.expr, results[i].Pass, tt.pass)
+		}
+		if got := results[i].ActualString(false); got != tt.actual {
+			t.Fatalf("%s actual = %q, want %q", tt.expr, got, tt.actual)
+		}
+	}
+}
+
+func TestPrinterFormatsThresholds(t *testing.T) {
+	pass, _ := ParseThreshold("p99<1s")
+	fail, _ := ParseThreshold("5xx<1")
+	printer := NewPrinter(3, 0, false, false)
+	printer.thresholds = []*Threshold{pass, fail}
+
+	var buf bytes.Buffer
+	printer.formatTableReports(&buf, testSnapshotReport(), false, false)
+	if strings.Contains(buf.String(), "Thresholds:") {
+		t.Fatalf("thresholds printed before the final report:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	printer.formatTableReports(&buf, testSnapshotReport(), true, false)
+	out := buf.String()
+	for _, want := range []string{"Thresholds:", "p99<1s", "PASS", "5xx<1", "FAIL"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("table output is missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	printer.formatJSONReports(&buf, testSnapshotReport(), true, false)
+	var got struct {
+		Thresholds []struct {
+			Threshold string `json:"Threshold"`
+			Actual    string `json:"Actual"`
+			Pass      bool   `json:"Pass"`
+		} `json:"Thresholds"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("formatJSONReports produced invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(got.Thresholds) != 2 || !got.Thresholds[0].Pass || got.Thresholds[1].Pass || got.Thresholds[1].Actual != "1" {
+		t.Fatalf("Thresholds = %+v, want p99 passing and 5xx failing", got.Thresholds)
+	}
+}
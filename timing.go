@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// The phases of a request measured with --timings. The connection phases
+// only count the requests that opened a connection.
+const (
+	phaseDNS = iota
+	phaseConnect
+	phaseTLS
+	phaseTTFB
+	phaseTransfer
+	phaseCount
+)
+
+var phaseNames = [phaseCount]string{"DNS", "Connect", "TLS", "TTFB", "Transfer"}
+
+func isConnPhase(phase int) bool {
+	return phase < phaseTTFB
+}
+
+// requestTrace measures the phases of the requests of a worker, which sends
+// them over its own connection so that the dial and the MyConn reads and
+// writes belong to its current request.
+type requestTrace struct {
+	client   *fasthttp.HostClient
+	dial     fasthttp.DialFunc
+	rs       *resolver
+	lookup   bool
+	tlsConf  *tls.Config
+	timeout  time.Duration
+	isTLS    bool
+	r, w     *int64
+	conn     [phaseTTFB]time.Duration
+	opened   bool
+	wrote    time.Time
+	received time.Time
+}
+
+func newRequestTrace(opt *ClientOpt, r *int64, w *int64, cs *connStats) (*requestTrace, error) {
+	o := *opt
+	o.maxConns = 1
+	client, _, err := buildRequestClient(&o, r, w, cs)
+	if err != nil {
+		return nil, err
+	}
+	tr := &requestTrace{
+		client:  client,
+		timeout: opt.dialTimeout,
+		isTLS:   client.IsTLS,
+		r:       r,
+		w:       w,
+		// proxies and unix sockets resolve the host themselves
+		lookup: opt.socks5Proxy == "" && opt.httpProxy == "" && opt.unixSocket == "",
+	}
+	// the resolver is applied before the dial to time it
+	o.resolve, o.dnsServer, o.dnsMode = nil, "", ""
+	if tr.dial, err = buildDialFunc(&o); err != nil {
+		return nil, err
+	}
+	if tr.rs, err = newResolver(opt); err != nil {
+		return nil, err
+	}
+	if tr.tlsConf, err = buildTLSConfig(opt); err != nil {
+		return nil, err
+	}
+	client.Dial = tr.dialConn
+	if cs != nil && keepAliveSet(opt) {
+		client.Dial = func(addr string) (net.Conn, error) {
+			return cs.track(tr.dialConn(addr))
+		}
+	}
+	return tr, nil
+}
+
+// resolve returns the addresses to try for addr.
+func (tr *requestTrace) resolve(addr string) ([]string, error) {
+	if !tr.lookup {
+		return []string{addr}, nil
+	}
+	if tr.rs != nil {
+		resolved, err := tr.rs.resolve(addr)
+		return []string{resolved}, err
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return []string{addr}, nil
+	}
+	ctx := context.Background()
+	if tr.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tr.timeout)
+		defer cancel()
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.JoinHostPort(ip.IP.String(), port)
+	}
+	return addrs, nil
+}
+
+// dialConn opens a connection timing each of its phases, the TLS handshake
+// is done here rather than by fasthttp.
+func (tr *requestTrace) dialConn(addr string) (net.Conn, error) {
+	start := time.Now()
+	addrs, err := tr.resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+	tr.conn[phaseDNS] = time.Since(start)
+
+	start = time.Now()
+	var conn net.Conn
+	for _, a := range addrs {
+		if conn, err = tr.dial(a); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	tr.conn[phaseConnect] = time.Since(start)
+	conn = &MyConn{Conn: conn, r: tr.r, w: tr.w, trace: tr}
+
+	tr.conn[phaseTLS] = 0
+	if tr.isTLS {
+		start = time.Now()
+		if conn, err = tlsHandshake(conn, tr.tlsConf, addr, tr.timeout); err != nil {
+			return nil, err
+		}
+		tr.conn[phaseTLS] = time.Since(start)
+	}
+	tr.opened = true
+	tr.wrote, tr.received = time.Time{}, time.Time{}
+	return conn, nil
+}
+
+func (tr *requestTrace) start() {
+	tr.opened = false
+	tr.wrote, tr.received = time.Time{}, time.Time{}
+}
+
+// onWrite and onRead are called by the MyConn of the worker.
+func (tr *requestTrace) onWrite() {
+	if tr.received.IsZero() {
+		tr.wrote = time.Now()
+	}
+}
+
+func (tr *requestTrace) onRead() {
+	if tr.received.IsZero() {
+		tr.received = time.Now()
+	}
+}
+
+// finish sets the phases of rr once the response has been read.
+func (tr *requestTrace) finish(rr *ReportRecord) {
+	end := time.Now()
+	rr.timed = true
+	rr.opened = tr.opened
+	rr.phases = [phaseCount]time.Duration{}
+	if tr.opened {
+		copy(rr.phases[:], tr.conn[:])
+	}
+	if !tr.wrote.IsZero() && !tr.received.IsZero() {
+		rr.phases[phaseTTFB] = tr.received.Sub(tr.wrote)
+		rr.phases[phaseTransfer] = end.Sub(tr.received)
+	}
+}
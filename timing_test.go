@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestTimingsMeasureThePhases(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Length", "8")
+		_, _ = w.Write([]byte("firs"))
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte("last"))
+	}))
+	defer server.Close()
+
+	requester, err := NewRequester(1, 3, 0, nil, io.Discard, &ClientOpt{
+		url:         server.URL,
+		method:      fasthttp.MethodGet,
+		insecure:    true,
+		timings:     true,
+		maxConns:    1,
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := collectRecords(t, requester)
+	if len(records) != 3 {
+		t.Fatalf("%d records, want 3", len(records))
+	}
+	for i, rr := range records {
+		if rr.code != fasthttp.StatusOK || !rr.timed {
+			t.Fatalf("record #%d = code %d error %q timed %v, want a timed 200", i, rr.code, rr.error, rr.timed)
+		}
+		if rr.opened != (i == 0) {
+			t.Fatalf("record #%d opened = %v, want only the first request to open the connection", i, rr.opened)
+		}
+		if i == 0 && (rr.phases[phaseConnect] <= 0 || rr.phases[phaseTLS] <= 0) {
+			t.Fatalf("connection phases = %v, want a connect and a TLS time", rr.phases)
+		}
+		if i > 0 && (rr.phases[phaseConnect] != 0 || rr.phases[phaseTLS] != 0) {
+			t.Fatalf("record #%d phases = %v, want no connection phases on a kept alive connection", i, rr.phases)
+		}
+		if ttfb, transfer := rr.phases[phaseTTFB], rr.phases[phaseTransfer]; ttfb < 20*time.Millisecond || transfer < 15*time.Millisecond || ttfb+transfer > rr.cost {
+			t.Fatalf("record #%d ttfb %s transfer %s cost %s, want the server wait and the body delay", i, ttfb, transfer, rr.cost)
+		}
+	}
+
+	if _, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: server.URL, timings: true, h2: true}, -1); err == nil {
+		t.Fatal("NewRequester accepted --timings with --h2")
+	}
+}
+
+func TestStreamReportTimings(t *testing.T) {
+	records := make(chan *ReportRecord, 3)
+	records <- &ReportRecord{cost: 5 * time.Millisecond, code: 200, timed: true, opened: true,
+		phases: [phaseCount]time.Duration{time.Millisecond, time.Millisecond, 2 * time.Millisecond, time.Millisecond, 0}}
+	records <- &ReportRecord{cost: 2 * time.Millisecond, code: 200, timed: true,
+		phases: [phaseCount]time.Duration{0, 0, 0, 2 * time.Millisecond, 0}}
+	records <- &ReportRecord{cost: time.Millisecond, code: 200}
+	close(records)
+
+	report := NewStreamReport()
+	report.Collect(records)
+	snapshot := report.Snapshot()
+	if len(snapshot.Timings) != phaseCount {
+		t.Fatalf("%d timings, want %d", len(snapshot.Timings), phaseCount)
+	}
+	for i, want := range []int64{1, 1, 1, 2, 2} {
+		if phase := snapshot.Timings[i]; phase.Label != phaseNames[i] || phase.Count != want {
+			t.Fatalf("%s counted %d requests, want %d", phase.Label, phase.Count, want)
+		}
+	}
+	if tls := snapshot.Timings[phaseTLS].Stats.Mean; tls != 2*time.Millisecond {
+		t.Fatalf("TLS mean = %s, want 2ms", tls)
+	}
+	if NewStreamReport().Snapshot().Timings != nil {
+		t.Fatal("a report without timed records has timings")
+	}
+}
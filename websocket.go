@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	url2 "net/url"
+	"strings"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"golang.org/x/time/rate"
+)
+
+const (
+	wsHandshakeLabel = "ws handshake"
+	wsMessageLabel   = "ws message"
+)
+
+// wsClient opens the WebSocket connections of the ws:// and wss:// mode.
+// Every worker owns one connection and replays the message sequence on it,
+// waiting for one reply per message.
+type wsClient struct {
+	dialer      *websocket.Dialer
+	url         string
+	header      http.Header
+	messages    [][]byte
+	messageType int
+	timeout     time.Duration
+}
+
+func isWebSocketURL(u *url2.URL) bool {
+	return u.Scheme == "ws" || u.Scheme == "wss"
+}
+
+func newWSClient(opt *ClientOpt, r, w *int64) (*wsClient, error) {
+	dial, err := buildDialFunc(opt)
+	if err != nil {
+		return nil, err
+	}
+	dial = ThroughputInterceptorDial(dial, r, w)
+	tlsConfig, err := buildTLSConfig(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	for _, h := range opt.headers {
+		n := strings.SplitN(h, ":", 2)
+		if len(n) != 2 {
+			return nil, fmt.Errorf("invalid header: %s", h)
+		}
+		header.Add(strings.TrimSpace(n[0]), strings.TrimSpace(n[1]))
+	}
+	if opt.host != "" {
+		header.Set("Host", opt.host)
+	}
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", "plow")
+	}
+
+	c := &wsClient{
+		dialer: &websocket.Dialer{
+			NetDial: func(_, addr string) (net.Conn, error) {
+				return dial(addr)
+			},
+			TLSClientConfig:  tlsConfig,
+			HandshakeTimeout: opt.dialTimeout,
+		},
+		url:         opt.url,
+		header:      header,
+		messageType: websocket.TextMessage,
+		timeout:     opt.doTimeout,
+	}
+	if opt.wsBinary {
+		c.messageType = websocket.BinaryMessage
+	}
+	for _, m := range opt.wsMessages {
+		c.messages = append(c.messages, []byte(m))
+	}
+	return c, nil
+}
+
+func (c *wsClient) handshake(rr *ReportRecord) *websocket.Conn {
+	startTime := time.Now()
+	conn, resp, err := c.dialer.Dial(c.url, c.header)
+	rr.cost = time.Since(startTime)
+	rr.code = 0
+	rr.error = ""
+	if resp != nil {
+		rr.code = resp.StatusCode
+	}
+	if err != nil {
+		rr.error = err.Error()
+		return nil
+	}
+	return conn
+}
+
+// roundTrip sends one message and waits for the next message from the
+// server, the cost is the round-trip time.
+func (c *wsClient) roundTrip(conn *websocket.Conn, msg []byte, rr *ReportRecord) bool {
+	startTime := time.Now()
+	if c.timeout > 0 {
+		_ = conn.SetWriteDeadline(startTime.Add(c.timeout))
+		_ = conn.SetReadDeadline(startTime.Add(c.timeout))
+	}
+	err := conn.WriteMessage(c.messageType, msg)
+	if err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	rr.cost = time.Since(startTime)
+	rr.code = 0
+	rr.error = ""
+	if err != nil {
+		rr.error = err.Error()
+		return false
+	}
+	return true
+}
+
+func (c *wsClient) close(conn *websocket.Conn) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	_ = conn.Close()
+}
+
+// runWebSocketWorker is the worker loop of the WebSocket mode. Without
+// messages every request is a new handshake, otherwise a connection is only
+// reopened after an error. -n and --rate apply to the handshakes and the
+// messages alike, so a dead endpoint isn't retried in a tight loop.
+func (r *Requester) runWebSocketWorker(ctx context.Context, cancel func(), limiter *rate.Limiter, semaphore *int64, id int) {
+	var conn *websocket.Conn
+	defer func() {
+		if conn != nil {
+			r.ws.close(conn)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if conn == nil {
+			if !r.acquire(ctx, cancel, limiter, semaphore) {
+				continue
+			}
+			rr := recordPool.Get().(*ReportRecord)
+			conn = r.ws.handshake(rr)
+			r.sendRecord(rr, wsHandshakeLabel, id)
+			if conn == nil {
+				continue
+			}
+			if len(r.ws.messages) == 0 {
+				r.ws.close(conn)
+				conn = nil
+				continue
+			}
+		}
+
+		for _, msg := range r.ws.messages {
+			if !r.acquire(ctx, cancel, limiter, semaphore) {
+				break
+			}
+			rr := recordPool.Get().(*ReportRecord)
+			ok := r.ws.roundTrip(conn, msg, rr)
+			r.sendRecord(rr, wsMessageLabel, id)
+			if !ok {
+				_ = conn.Close()
+				conn = nil
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+func newWSEchoServer(t *testing.T, handshakes, messages *int32) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		atomic.AddInt32(handshakes, 1)
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(messages, 1)
+			if err := conn.WriteMessage(mt, msg); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func runWSRequester(t *testing.T, opt *ClientOpt, concurrency int, requests int64) map[string][]*ReportRecord {
+	t.Helper()
+	opt.dialTimeout = time.Second
+	opt.doTimeout = time.Second
+	requester, err := NewRequester(concurrency, requests, 0, nil, io.Discard, opt, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := map[string][]*ReportRecord{}
+	for _, rr := range collectRecords(t, requester) {
+		records[rr.label] = append(records[rr.label], rr)
+	}
+	if atomic.LoadInt64(&requester.readBytes) == 0 || atomic.LoadInt64(&requester.writeBytes) == 0 {
+		t.Fatal("read/write bytes were not counted")
+	}
+	return records
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	var handshakes, messages int32
+	server := newWSEchoServer(t, &handshakes, &messages)
+	defer server.Close()
+
+	records := runWSRequester(t, &ClientOpt{
+		url:        "ws" + strings.TrimPrefix(server.URL, "http") + "/echo",
+		headers:    []string{"X-Token: secret"},
+		wsMessages: []string{"hello", "world"},
+	}, 2, 10)
+
+	// -n counts the handshakes too, a worker may not get to open its own
+	opened := len(records[wsHandshakeLabel])
+	if opened < 1 || opened > 2 {
+		t.Fatalf("got %d handshakes, want at most one per worker", opened)
+	}
+	for _, rr := range records[wsHandshakeLabel] {
+		if rr.code != http.StatusSwitchingProtocols || rr.error != "" {
+			t.Fatalf("handshake record = code %d error %q, want 101", rr.code, rr.error)
+		}
+	}
+	if got := len(records[wsMessageLabel]); got != 10-opened {
+		t.Fatalf("got %d message records, want %d", got, 10-opened)
+	}
+	for _, rr := range records[wsMessageLabel] {
+		if rr.error != "" || rr.cost <= 0 {
+			t.Fatalf("message record = cost %s error %q, want a successful round trip", rr.cost, rr.error)
+		}
+	}
+	if got := atomic.LoadInt32(&messages); got != int32(10-opened) {
+		t.Fatalf("server got %d messages, want %d", got, 10-opened)
+	}
+}
+
+func TestWebSocketDeadEndpointStopsAtRequests(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	server.Close()
+
+	requester, err := NewRequester(2, 5, 0, nil, io.Discard, &ClientOpt{
+		url:         url,
+		wsMessages:  []string{"hello"},
+		dialTimeout: time.Second,
+		doTimeout:   time.Second,
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := collectRecords(t, requester)
+	for _, rr := range records {
+		if rr.label != wsHandshakeLabel || rr.error == "" {
+			t.Fatalf("record = %s error %q, want failed handshakes", rr.label, rr.error)
+		}
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d handshakes, want the 5 of -n", len(records))
+	}
+}
+
+func TestWebSocketHandshakesOnly(t *testing.T) {
+	var handshakes, messages int32
+	server := newWSEchoServer(t, &handshakes, &messages)
+	defer server.Close()
+
+	records := runWSRequester(t, &ClientOpt{
+		url:     "ws" + strings.TrimPrefix(server.URL, "http"),
+		headers: []string{"X-Token: secret"},
+	}, 2, 6)
+	if got := len(records[wsHandshakeLabel]); got != 6 {
+		t.Fatalf("got %d handshakes, want 6", got)
+	}
+	if len(records[wsMessageLabel]) != 0 {
+		t.Fatalf("got %d message records, want none", len(records[wsMessageLabel]))
+	}
+
+	records = runWSRequester(t, &ClientOpt{url: "ws" + strings.TrimPrefix(server.URL, "http")}, 1, 1)
+	if rr := records[wsHandshakeLabel][0]; rr.code != http.StatusForbidden || rr.error == "" {
+		t.Fatalf("rejected handshake record = code %d error %q, want 403 with an error", rr.code, rr.error)
+	}
+}
+
+func TestWebSocketMessageRequiresWebSocketURL(t *testing.T) {
+	_, err := NewRequester(1, 1, 0, nil, io.Discard, &ClientOpt{url: "http://127.0.0.1/", wsMessages: []string{"hi"}}, -1)
+	if err == nil {
+		t.Fatal("NewRequester succeeded with --ws-message and an http url, want error")
+	}
+}